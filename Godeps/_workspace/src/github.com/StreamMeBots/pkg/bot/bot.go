@@ -227,6 +227,11 @@ func (b *Bot) UnMute(userPublicId string) error {
 	return b.write(b.Room.UnMute(userPublicId))
 }
 
+// ChangeRole is used to change a user's role in chat
+func (b *Bot) ChangeRole(userPublicId string, role string) error {
+	return b.write(b.Room.ChangeRole(userPublicId, role))
+}
+
 // Erase a message
 func (b *Bot) Erase(messageId string) error {
 	return b.write(b.Room.Erase(messageId))
@@ -1,17 +1,28 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/StreamMeBots/meep/pkg/buckets"
 	"github.com/StreamMeBots/meep/pkg/config"
 	"github.com/StreamMeBots/meep/pkg/db"
+	"github.com/StreamMeBots/meep/pkg/stats"
+	"github.com/StreamMeBots/meep/pkg/transcripts"
 	"github.com/StreamMeBots/meep/routes"
 	"github.com/gin-gonic/contrib/static"
 	"github.com/gin-gonic/gin"
 )
 
+// ShutdownTimeout is how long in flight requests have to finish when the server is shutting down
+var ShutdownTimeout = time.Second * 10
+
 func main() {
 	// setup logger
 	log.SetPrefix("[BOT] ")
@@ -50,12 +61,41 @@ func main() {
 	// If a file is not found the client/index.html gets served
 	r.Use(static.Serve("/", Assets()))
 
-	//routes.Bots.Startup()
+	// write the stats counts and transcript entries periodically
+	go stats.Start()
+	go transcripts.Start()
+
+	// restart the bots that were running before the last shutdown
+	go routes.RestartBots()
 
 	// start server
-	if err := r.Run(":8888"); err != nil {
-		log.Fatal(err)
+	srv := &http.Server{Addr: ":8888", Handler: r}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+
+	// wait for a shutdown signal
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	log.Println("msg='shutting-down', signal='" + (<-sig).String() + "'")
+
+	// drain in flight requests
+	ctx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("msg='error-shutting-down-server', error='%v'\n", err)
 	}
 
-	//routes.Bots.Close()
+	// stop and record the running bots
+	routes.Close()
+
+	// write the stats counts and transcript entries that haven't been flushed yet
+	stats.Close()
+	transcripts.Close()
+
+	if err := db.DB.Close(); err != nil {
+		log.Printf("msg='error-closing-db', error='%v'\n", err)
+	}
 }
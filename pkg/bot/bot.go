@@ -6,6 +6,7 @@ import (
 	"io/ioutil"
 	"log"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 
@@ -16,7 +17,9 @@ import (
 
 	"github.com/StreamMeBots/meep/pkg/db"
 	"github.com/StreamMeBots/meep/pkg/greetings"
+	"github.com/StreamMeBots/meep/pkg/moderation"
 	"github.com/StreamMeBots/meep/pkg/stats"
+	"github.com/StreamMeBots/meep/pkg/viewers"
 	pkgBot "github.com/StreamMeBots/pkg/bot"
 	"github.com/StreamMeBots/pkg/commands"
 )
@@ -25,12 +28,27 @@ import (
 var (
 	ErrBotAlreadyStarted = errors.New("Bot is already running")
 	ErrAuthNon200        = errors.New("Unable to authorize bot")
+	ErrBotNotRunning     = errors.New("Bot is not running")
+	ErrBotsClosed        = errors.New("Bots are shutting down")
+	ErrPollRunning       = errors.New("A poll is already running")
+	ErrNoPollRunning     = errors.New("There is no poll running")
+	ErrGiveawayRunning   = errors.New("A giveaway is already running")
+	ErrNoGiveaway        = errors.New("There is no giveaway running")
+	ErrPointsOff         = errors.New("Points are turned off")
+	ErrTriviaRunning     = errors.New("A trivia question is already running")
+	ErrNoTrivia          = errors.New("There is no trivia question running")
+	ErrProtectedViewer   = errors.New("Moderators and the bot can't be moderated")
 )
 
+// answeringMachine rate limits the answering machine greeting like a command
+var answeringMachine = &command.Command{Name: "answeringMachine", Throttle: 2}
+
 // NewBots is the constructor for Bots
 func NewBots() Bots {
 	return Bots{
-		bots: map[string]Bot{},
+		bots:     map[string]Bot{},
+		starting: map[string]bool{},
+		restarts: map[string]RestartStatus{},
 	}
 }
 
@@ -38,49 +56,133 @@ func NewBots() Bots {
 type Bots struct {
 	bots map[string]Bot
 	sync.RWMutex
-	commandTimers []*command.Command
+	starting map[string]bool          // bots that are connecting to chat
+	restarts map[string]RestartStatus // results of restarting the bots that were running at shutdown
+	closed   bool                     // set by Close, bots can't be started after it
+	busy     sync.WaitGroup           // Startup and the bots that are starting, Close waits for them
+}
+
+// RestartStatus describes the outcome of restarting a bot on startup
+type RestartStatus struct {
+	Restarted bool      `json:"restarted"`
+	Error     string    `json:"error,omitempty"`
+	Time      time.Time `json:"time"`
 }
 
-// Start starts a user's bot
+// Info represents the state of a user's bot
+type Info struct {
+	pkgBot.Info
+	Restart *RestartStatus `json:"restart,omitempty"`
+}
+
+// Start starts a user's bot. Connecting to chat takes a while so the bot is marked as starting while it connects
+// instead of holding the lock.
 func (bs *Bots) Start(userPublicId string, client *http.Client) error {
-	bs.RLock()
-	if _, ok := bs.bots[userPublicId]; ok {
+	bs.Lock()
+	if bs.closed {
+		bs.Unlock()
+		return ErrBotsClosed
+	}
+	if _, ok := bs.bots[userPublicId]; ok || bs.starting[userPublicId] {
+		bs.Unlock()
 		return ErrBotAlreadyStarted
 	}
-	bs.RUnlock()
+	bs.starting[userPublicId] = true
+	bs.busy.Add(1)
+	bs.Unlock()
+	defer bs.busy.Done()
 
 	bt, err := NewBot(userPublicId, client)
-	if err != nil {
-		return err
-	}
 
 	bs.Lock()
 	defer bs.Unlock()
+	delete(bs.starting, userPublicId)
+	if err != nil {
+		return err
+	}
 	bs.bots[userPublicId] = bt
 	return nil
 }
 
-// TODO(james): finish
-func (b *Bot) startCommandTimers() {
-	/*
-		var err error
-		b.commandTimers, err = command.GetCommandsWithTimers(b.UserPublicId)
-		if err != nil {
+// ReloadCommandTimers tells a user's bot that its commands have changed so the timers can be rescheduled
+func (bs *Bots) ReloadCommandTimers(userPublicId string) {
+	bs.RLock()
+	defer bs.RUnlock()
 
-		}
-	*/
+	if b, ok := bs.bots[userPublicId]; ok {
+		b.timers.Reload()
+	}
+}
+
+// ReloadModeration tells a user's bot that its moderation filters have changed
+func (bs *Bots) ReloadModeration(userPublicId string) {
+	bs.RLock()
+	defer bs.RUnlock()
+
+	if b, ok := bs.bots[userPublicId]; ok {
+		b.moderator.Reload()
+	}
+}
+
+// Strike adds a strike to a viewer of a user's chat and takes the moderation ladder's action
+func (bs *Bots) Strike(userPublicId string, o moderation.Offense) (int, error) {
+	bs.RLock()
+	b, ok := bs.bots[userPublicId]
+	bs.RUnlock()
+	if !ok {
+		return 0, ErrBotNotRunning
+	}
+
+	if len(o.Role) == 0 {
+		o.Role = b.roles.get(o.UserPublicId)
+	}
+	return moderation.AddStrike(b.bucketKey(), b.bot, o)
+}
+
+// Timeout mutes a viewer of a user's chat until the timeout expires
+func (bs *Bots) Timeout(userPublicId string, t *moderation.Timeout) error {
+	bs.RLock()
+	b, ok := bs.bots[userPublicId]
+	bs.RUnlock()
+	if !ok {
+		return ErrBotNotRunning
+	}
+
+	if len(t.Role) == 0 {
+		t.Role = b.roles.get(t.UserPublicId)
+	}
+	return b.timeout(t)
+}
+
+// CancelTimeout ends a viewer's timeout early
+func (bs *Bots) CancelTimeout(userPublicId, viewerPublicId string) error {
+	bs.RLock()
+	b, ok := bs.bots[userPublicId]
+	bs.RUnlock()
+	if !ok {
+		return ErrBotNotRunning
+	}
+
+	return b.cancelTimeout(viewerPublicId)
 }
 
-func (bs *Bots) Info(userPublicId string) pkgBot.Info {
+func (bs *Bots) Info(userPublicId string) Info {
 	bs.RLock()
 	defer bs.RUnlock()
 
+	info := Info{}
+	if rs, ok := bs.restarts[userPublicId]; ok {
+		info.Restart = &rs
+	}
+
 	b, ok := bs.bots[userPublicId]
 	if !ok {
-		return pkgBot.Info{State: "notStarted"}
+		info.State = "notStarted"
+		return info
 	}
 
-	return b.bot.GetInfo()
+	info.Info = b.bot.GetInfo()
+	return info
 }
 
 // NewBot is the constructor for Bot
@@ -91,19 +193,36 @@ func NewBot(userPublicId string, client *http.Client) (Bot, error) {
 	bt := Bot{
 		UserPublicId: userPublicId,
 		stop:         make(chan struct{}),
+		tasks:        &tasks{},
 		client:       client,
+		timers:       newReloader(),
+		timeouts:     newReloader(),
+		recent:       newRecentMessages(),
+		roles:        newViewerRoles(),
+		moderator:    moderation.NewModerator([]byte(userPublicId)),
+		cooldowns:    newCooldowns(),
+		events:       newEvents(),
+		poll:         &activePoll{},
+		giveaway:     &activeGiveaway{},
+		presence:     newPresence(),
+		trivia:       &activeTrivia{},
+	}
+
+	if config.Conf.PersistCooldowns {
+		bt.cooldowns.load(bt.bucketKey())
 	}
+	bt.giveaway.resume(bt.bucketKey())
 
 	conf := []pkgBot.Config{}
 	if config.Conf.Debug {
 		conf = append(conf, pkgBot.LogCommands)
 	}
 
-	var err error
-	bt.bot, err = pkgBot.New(config.Conf.ChatHost, config.Conf.BotKey, config.Conf.BotSecret, userPublicId, conf...)
+	pb, err := pkgBot.New(config.Conf.ChatHost, config.Conf.BotKey, config.Conf.BotSecret, userPublicId, conf...)
 	if err != nil {
 		return bt, err
 	}
+	bt.bot = &chatBot{Bot: pb, botBucket: bt.bucketKey()}
 
 	// auth bot with user's chat room
 	if err := bt.auth(); err != nil {
@@ -115,27 +234,121 @@ func NewBot(userPublicId string, client *http.Client) (Bot, error) {
 	}
 
 	go bt.read()
+	bt.tasks.run(bt.startCommandTimers)
+	bt.tasks.run(bt.startTimeouts)
+	bt.tasks.run(bt.startPoints)
+	bt.tasks.run(bt.resumePrediction)
+	bt.tasks.run(bt.startGiveawaySaving)
+	bt.tasks.run(bt.startTrivia)
+	bt.tasks.run(bt.startTranscriptPruning)
 
 	return bt, nil
 }
 
-func (bs *Bots) Startup() {
+// Startup restarts the bots that were running when Close was called. clientFor is used to recreate each user's
+// authorized client.
+func (bs *Bots) Startup(clientFor func(userPublicId string) (*http.Client, error)) {
+	bs.Lock()
+	if bs.closed {
+		bs.Unlock()
+		return
+	}
+	bs.busy.Add(1)
+	bs.Unlock()
+	defer bs.busy.Done()
+
+	ids := []string{}
+	err := db.DB.View(func(tx *bolt.Tx) error {
+		return buckets.RunningBots(tx).ForEach(func(k, v []byte) error {
+			ids = append(ids, string(k))
+			return nil
+		})
+	})
+	if err != nil {
+		log.Printf("msg='error-getting-running-bots', error='%v'\n", err)
+		return
+	}
+
+	// connecting to chat can take a while so start the bots concurrently
+	wg := sync.WaitGroup{}
+	for _, id := range ids {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+
+			rs := RestartStatus{Restarted: true}
+
+			client, err := clientFor(id)
+			if err == nil {
+				err = bs.Start(id, client)
+			}
+			if err != nil {
+				log.Printf("msg='error-restarting-bot', userPublicId='%s', error='%v'\n", id, err)
+				rs.Restarted = false
+				rs.Error = err.Error()
+			}
+			rs.Time = time.Now()
+
+			bs.Lock()
+			bs.restarts[id] = rs
+			bs.Unlock()
+		}(id)
+	}
+	wg.Wait()
+
+	// the bots that restarted get saved again on Close, the others are tried again on the next startup
+	err = db.DB.Update(func(tx *bolt.Tx) error {
+		bkt := buckets.RunningBots(tx)
+		for _, id := range ids {
+			if !bs.restarted(id) {
+				continue
+			}
+			if err := bkt.Delete([]byte(id)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("msg='error-deleting-running-bots', error='%v'\n", err)
+	}
+}
 
+// restarted checks if Startup restarted a user's bot
+func (bs *Bots) restarted(userPublicId string) bool {
+	bs.RLock()
+	defer bs.RUnlock()
+	return bs.restarts[userPublicId].Restarted
 }
 
-// Close stops all bots and saves the user's public id so the bots can be restarted on startup
+// Close stops all bots and saves the user's public id so the bots can be restarted on startup. It returns once the
+// bots have stopped using the db.
 func (bs *Bots) Close() {
+	bs.Lock()
+	bs.closed = true
+	bs.Unlock()
+
+	// the bots that are starting are stopped with the others
+	bs.busy.Wait()
+
 	bs.Lock()
 	defer bs.Unlock()
 
+	for _, b := range bs.bots {
+		close(b.stop)
+	}
+	for _, b := range bs.bots {
+		b.tasks.wait()
+		b.saveCooldowns()
+	}
+
 	db.DB.Update(func(tx *bolt.Tx) error {
 		bkt := buckets.RunningBots(tx)
-		for id, b := range bs.bots {
-			close(b.stop)
+		for id := range bs.bots {
 			delete(bs.bots, id)
 
 			if err := bkt.Put([]byte(id), []byte(id)); err != nil {
-				log.Println("msg='error-saving-running-bot-id', id='%s' error='%v'", id, err)
+				log.Printf("msg='error-saving-running-bot-id', id='%s' error='%v'\n", id, err)
 				continue
 			}
 		}
@@ -148,24 +361,57 @@ func (bs *Bots) Stop(userPublicId string) {
 	bs.Lock()
 	b, ok := bs.bots[userPublicId]
 	delete(bs.bots, userPublicId)
+	delete(bs.restarts, userPublicId)
 	bs.Unlock()
 
 	if ok {
 		close(b.stop)
+		b.tasks.wait()
+		b.saveCooldowns()
 	}
 }
 
-// LogStream returns a channel that can be used to listen for events
+// LogStream returns a channel that can be used to listen for events. The chat events and the bot's own events,
+// e.g. EventPoll, are sent down the same channel.
 func (bs *Bots) LogStream(userPublicId string) (chan interface{}, error) {
 	bs.RLock()
 	defer bs.RUnlock()
 
 	b, ok := bs.bots[userPublicId]
 	if !ok {
-		return nil, fmt.Errorf("Bot is not running")
+		return nil, ErrBotNotRunning
 	}
 
-	c := b.bot.Subscribe(userPublicId)
+	chat := b.bot.Subscribe(userPublicId)
+	own := b.events.subscribe(userPublicId)
+	c := make(chan interface{}, 10)
+	go func() {
+		defer close(c)
+		for {
+			var e interface{}
+			select {
+			case ev, ok := <-chat:
+				if !ok {
+					b.events.unsubscribe(userPublicId)
+					return
+				}
+				e = ev
+			case ev, ok := <-own:
+				if !ok {
+					b.bot.Unsubscribe(userPublicId)
+					return
+				}
+				e = ev
+			}
+
+			select {
+			case c <- e:
+			default:
+				// the listener isn't keeping up
+			}
+		}
+	}()
+
 	return c, nil
 }
 
@@ -179,45 +425,130 @@ func (bs *Bots) CloseLogStream(userPublicId string) {
 	}
 
 	b.bot.Unsubscribe(userPublicId)
+	b.events.unsubscribe(userPublicId)
 }
 
 // Bot represents a bot that is associated to a stream.me user
 type Bot struct {
 	UserPublicId string
-	bot          *pkgBot.Bot
+	bot          *chatBot
 	stop         chan struct{}
+	tasks        *tasks // the bot's goroutines that use the db
 	client       *http.Client
+	timers       reloader // reloads the command timers
+	timeouts     reloader // reloads the timeouts
+	recent       *recentMessages
+	roles        *viewerRoles
+	moderator    *moderation.Moderator
+	cooldowns    *cooldowns
+	events       *events
+	poll         *activePoll
+	giveaway     *activeGiveaway
+	presence     *presence // viewers in chat, for points
+	trivia       *activeTrivia
 }
 
 func (b *Bot) bucketKey() []byte {
 	return []byte(b.UserPublicId)
 }
 
+// saveCooldowns saves the bot's cooldowns if they should survive restarts
+func (b *Bot) saveCooldowns() {
+	if config.Conf.PersistCooldowns {
+		b.cooldowns.save(b.bucketKey())
+	}
+}
+
 // read is responsible for reading commands from the chat room then routing the commands to a bot method
 func (b *Bot) read() {
 	for {
-		// check if we need to close down
+		// read chat command
+		cmd, err := b.bot.Read()
+
+		// check if we need to close down, the read can outlast the bot so commands are only handled while it's
+		// running
 		select {
 		case <-b.stop:
 			b.bot.Leave()
 			return
 		default:
 		}
-
-		// read chat command
-		cmd, err := b.bot.Read()
 		if err != nil {
 			continue
 		}
 
-		// route
-		switch cmd.Name {
-		case commands.LJoin:
-			b.join(cmd)
-		case commands.LSay:
-			b.say(cmd)
+		if !b.tasks.add() {
+			b.bot.Leave()
+			return
 		}
+		b.handle(cmd)
+		b.tasks.done()
+	}
+}
+
+// handle routes a chat command to a bot method
+func (b *Bot) handle(cmd *commands.Command) {
+	b.record(cmd)
+	if cmd.Name == commands.LJoin || cmd.Name == commands.LSay {
+		b.roles.seen(cmd.Get("publicId"), cmd.Get("role"))
+	}
+	if cmd.Name == commands.LSay && cmd.Get("bot") == "true" {
+		b.roles.seenBot(cmd.Get("publicId"))
+	}
+
+	// route
+	switch cmd.Name {
+	case commands.LJoin:
+		b.join(cmd)
+	case commands.LSay:
+		b.say(cmd)
+	case commands.LLeave:
+		b.presence.leave(cmd.Get("publicId"))
+	}
+}
+
+// tasks tracks a bot's goroutines so shutdown can wait for them before the db is closed
+type tasks struct {
+	mx     sync.Mutex
+	wg     sync.WaitGroup
+	closed bool
+}
+
+// add adds a task, false is returned if the bot is stopping and the task shouldn't run
+func (t *tasks) add() bool {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+
+	if t.closed {
+		return false
+	}
+	t.wg.Add(1)
+	return true
+}
+
+func (t *tasks) done() {
+	t.wg.Done()
+}
+
+// run runs fn in a goroutine as a task
+func (t *tasks) run(fn func()) {
+	if !t.add() {
+		return
 	}
+	go func() {
+		defer t.done()
+		fn()
+	}()
+}
+
+// wait stops new tasks from being added and waits for the running ones. The bot's stop channel should be closed
+// first.
+func (t *tasks) wait() {
+	t.mx.Lock()
+	t.closed = true
+	t.mx.Unlock()
+
+	t.wg.Wait()
 }
 
 // auth authorizes the bot with the user's chat room
@@ -260,23 +591,111 @@ func (b *Bot) say(cmd *commands.Command) {
 	isCommand := false
 	defer func() {
 		if !isCommand {
+			b.cooldowns.line()
 			stats.Line(b.bucketKey())
 		}
 	}()
 
+	b.recent.add(cmd.Get("publicId"), cmd.Get("messageId"))
+
+	// moderated messages are not handled any further
+	if b.moderate(cmd) {
+		return
+	}
+	b.messagePoints(cmd)
+
+	// giveaway entries can use any keyword
+	if b.enterGiveaway(cmd) {
+		return
+	}
+
+	// answers to trivia are checked by the running question's goroutine
+	b.guessTrivia(cmd)
+
 	m := cmd.Get("message")
 	if len(m) > 2 && m[0] == '!' {
-		c, err := command.Get(b.bucketKey(), m)
+		// built in commands
+		if b.runBuiltinCommand(cmd) {
+			isCommand = true
+			return
+		}
+
+		// moderators changing a counter
+		if b.counterCommand(cmd) {
+			isCommand = true
+			return
+		}
+
+		c, err := b.findCommand(m)
 		if err != nil {
 			return
 		}
 
-		if stats.Command(b.bucketKey(), c) {
-			if msg := c.Parse(cmd); len(msg) > 0 {
-				b.bot.Say(msg)
-				isCommand = true
+		if !c.Allowed(cmd.Get("role"), b.viewerTags(cmd.Get("publicId"))) {
+			if len(c.DenyMessage) > 0 {
+				b.bot.Say(c.DenyMessage)
+			}
+			return
+		}
+
+		// the cooldown is only used up when the command runs, the usage has a cooldown of its own
+		if err := c.CheckArgs(command.Data(cmd.Args).Args()); err != nil {
+			if b.cooldowns.allow(&command.Command{Name: c.Name + " usage"}, cmd.Get("publicId"), cmd.Get("role")) {
+				b.bot.Say(err.Error())
 			}
+			isCommand = true
+			return
+		}
+
+		if !b.cooldowns.allow(c, cmd.Get("publicId"), cmd.Get("role")) {
+			return
+		}
+
+		if msg := c.Parse(b.bucketKey(), cmd); len(msg) > 0 {
+			stats.Command(b.bucketKey(), c)
+			b.bot.Say(msg)
+			isCommand = true
+		}
+	}
+}
+
+// findCommand gets the command a message uses. The whole message is tried first for commands with spaces in their
+// names, then the first word so the command can be given arguments.
+func (b *Bot) findCommand(m string) (*command.Command, error) {
+	c, err := command.Get(b.bucketKey(), m)
+	if err != command.ErrCommandNotFound {
+		return c, err
+	}
+
+	words := strings.Fields(m)
+	if len(words) < 2 {
+		return nil, err
+	}
+	return command.Get(b.bucketKey(), words[0])
+}
+
+// moderate checks the message against the moderation filters and takes the filter's action if the message breaks
+// one of them
+func (b *Bot) moderate(cmd *commands.Command) bool {
+	v := b.moderator.Check(cmd)
+	if v == nil {
+		return false
+	}
+
+	if err := v.Apply(b.bot); err != nil {
+		log.Printf("msg='error-applying-moderation', filter='%s', action='%s', error='%v'\n", v.Filter.Name, v.Filter.Action, err)
+	}
+	return true
+}
+
+// viewerTags returns a function that gets a viewer's tags
+func (b *Bot) viewerTags(userPublicId string) func() []string {
+	return func() []string {
+		t, err := viewers.GetTags(b.bucketKey(), userPublicId)
+		if err != nil {
+			return nil
 		}
+		return t.Tags
 	}
 }
 
@@ -292,13 +711,17 @@ func (b *Bot) join(cmd *commands.Command) {
 		}
 	*/
 
+	b.presence.join(cmd.Get("publicId"), cmd.Get("username"))
+
 	e := greetings.Join(b.bucketKey(), cmd)
+	b.streakPoints(e)
 	if len(e.Response) > 0 {
 		if e.Private {
 			// TODO: meep command only
 		} else {
 			if e.Type == "answeringMachine" {
-				if stats.Command(b.bucketKey(), &command.Command{Name: "answeringMachine"}) {
+				if b.cooldowns.allow(answeringMachine, cmd.Get("publicId"), cmd.Get("role")) {
+					stats.Command(b.bucketKey(), answeringMachine)
 					// FIXIME:
 					time.Sleep(time.Second)
 					b.bot.Say(e.Response)
@@ -0,0 +1,187 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/StreamMeBots/meep/pkg/command"
+	"github.com/StreamMeBots/pkg/commands"
+)
+
+// MaxMessageLength is the longest message the bot says at once
+var MaxMessageLength = 500
+
+// commandName adds the leading ! to a command name typed in chat
+func commandName(name string) string {
+	if strings.HasPrefix(name, "!") {
+		return name
+	}
+	return "!" + name
+}
+
+// afterFields returns the message after its first n words, keeping the spacing of the rest
+func afterFields(msg string, n int) string {
+	for i := 0; i < n; i++ {
+		msg = strings.TrimLeft(msg, " \t")
+		j := strings.IndexAny(msg, " \t")
+		if j < 0 {
+			return ""
+		}
+		msg = msg[j:]
+	}
+	return strings.TrimSpace(msg)
+}
+
+// saveCommand validates and saves a command changed from chat. The returned message is empty if the command was
+// saved.
+func (b *Bot) saveCommand(c *command.Command) string {
+	if err := c.Validate(); err != nil {
+		return err.Error()
+	}
+
+	if err := c.Save(b.bucketKey()); err != nil {
+		return "Something went wrong, try again"
+	}
+
+	// pick up any timer changes
+	b.timers.Reload()
+	return ""
+}
+
+// addComCommand: !addcom <!name> <template>
+func (b *Bot) addComCommand(cmd *commands.Command, args []string) string {
+	if len(args) < 2 {
+		return "Usage: !addcom <!name> <template>"
+	}
+
+	name := commandName(args[0])
+	if _, err := command.Get(b.bucketKey(), name); err == nil {
+		return fmt.Sprintf("%s already exists, use !editcom to change it", name)
+	}
+
+	c := &command.Command{
+		Name:     name,
+		Template: afterFields(cmd.Get("message"), 2),
+	}
+	if msg := b.saveCommand(c); len(msg) > 0 {
+		return msg
+	}
+
+	return fmt.Sprintf("%s has been added", name)
+}
+
+// editComCommand: !editcom <!name> <template>
+func (b *Bot) editComCommand(cmd *commands.Command, args []string) string {
+	if len(args) < 2 {
+		return "Usage: !editcom <!name> <template>"
+	}
+
+	name := commandName(args[0])
+	c, err := command.Get(b.bucketKey(), name)
+	if err == command.ErrCommandNotFound {
+		return fmt.Sprintf("%s doesn't exist, use !addcom to add it", name)
+	} else if err != nil {
+		return "Something went wrong, try again"
+	}
+
+	c.Template = afterFields(cmd.Get("message"), 2)
+	if msg := b.saveCommand(c); len(msg) > 0 {
+		return msg
+	}
+
+	return fmt.Sprintf("%s has been updated", name)
+}
+
+// renameComCommand: !renamecom <!name> <!newname>
+func (b *Bot) renameComCommand(cmd *commands.Command, args []string) string {
+	if len(args) < 2 {
+		return "Usage: !renamecom <!name> <!newname>"
+	}
+
+	name, newName := commandName(args[0]), commandName(args[1])
+	c, err := command.Get(b.bucketKey(), name)
+	if err == command.ErrCommandNotFound {
+		return fmt.Sprintf("%s doesn't exist", name)
+	} else if err != nil {
+		return "Something went wrong, try again"
+	}
+
+	if _, err := command.Get(b.bucketKey(), newName); err == nil {
+		return fmt.Sprintf("%s already exists", newName)
+	}
+
+	c.Name = newName
+	if msg := b.saveCommand(c); len(msg) > 0 {
+		return msg
+	}
+
+	if err := command.Delete(b.bucketKey(), name); err != nil {
+		return "Something went wrong, try again"
+	}
+	b.timers.Reload()
+
+	return fmt.Sprintf("%s has been renamed to %s", name, newName)
+}
+
+// delComCommand: !delcom <!name>
+func (b *Bot) delComCommand(cmd *commands.Command, args []string) string {
+	if len(args) < 1 {
+		return "Usage: !delcom <!name>"
+	}
+
+	name := commandName(args[0])
+	if _, err := command.Get(b.bucketKey(), name); err == command.ErrCommandNotFound {
+		return fmt.Sprintf("%s doesn't exist", name)
+	} else if err != nil {
+		return "Something went wrong, try again"
+	}
+
+	if err := command.Delete(b.bucketKey(), name); err != nil {
+		return "Something went wrong, try again"
+	}
+	b.timers.Reload()
+
+	return fmt.Sprintf("%s has been deleted", name)
+}
+
+// commandsCommand: !commands lists the custom commands, split over several messages when the list is long
+func (b *Bot) commandsCommand(cmd *commands.Command, args []string) string {
+	cmds, err := command.GetAll(b.bucketKey())
+	if err != nil {
+		log.Printf("msg='error-listing-commands', userPublicId='%s', error='%v'\n", b.UserPublicId, err)
+		return "Something went wrong, try again"
+	}
+	if len(cmds) == 0 {
+		return "There are no commands yet, use !addcom to add one"
+	}
+
+	names := make([]string, len(cmds))
+	for i, c := range cmds {
+		names[i] = c.Name
+	}
+	sort.Strings(names)
+
+	for _, msg := range splitMessage("Commands: ", names, ", ") {
+		b.bot.Say(msg)
+	}
+	return ""
+}
+
+// splitMessage joins the parts into messages no longer than MaxMessageLength
+func splitMessage(prefix string, parts []string, sep string) []string {
+	msgs := []string{}
+	msg := prefix
+	for _, p := range parts {
+		if msg != prefix && len(msg)+len(sep)+len(p) > MaxMessageLength {
+			msgs = append(msgs, msg)
+			msg = prefix
+		}
+		if msg != prefix {
+			msg += sep
+		}
+		msg += p
+	}
+	return append(msgs, msg)
+}
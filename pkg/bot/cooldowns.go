@@ -0,0 +1,148 @@
+package bot
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/StreamMeBots/meep/pkg/buckets"
+	"github.com/StreamMeBots/meep/pkg/command"
+	"github.com/StreamMeBots/meep/pkg/db"
+	"github.com/StreamMeBots/meep/pkg/moderation"
+
+	"github.com/boltdb/bolt"
+)
+
+// maxCooldownViewers is the number of viewers remembered for a command before the expired ones are forgotten
+var maxCooldownViewers = 1000
+
+// cooldownsKey is the key the cooldowns are saved under in the bot's cooldowns bucket
+var cooldownsKey = []byte("cooldowns")
+
+// commandUse is when a command was last used
+type commandUse struct {
+	Time time.Time `json:"time"`
+	Line int64     `json:"line"` // the chat line count when the command was used
+}
+
+// cooldowns keeps track of when the bot's commands were used so they can be rate limited. The state is kept in
+// memory, see load and save to keep it across restarts.
+type cooldowns struct {
+	mx      sync.Mutex
+	Lines   int64                           `json:"lines"`   // chat lines that were not commands
+	Last    map[string]commandUse           `json:"last"`    // command name -> last use
+	Viewers map[string]map[string]time.Time `json:"viewers"` // command name -> viewer public id -> last use
+}
+
+func newCooldowns() *cooldowns {
+	return &cooldowns{
+		Last:    map[string]commandUse{},
+		Viewers: map[string]map[string]time.Time{},
+	}
+}
+
+// line counts a chat line for the line throttles
+func (c *cooldowns) line() {
+	c.mx.Lock()
+	c.Lines++
+	c.mx.Unlock()
+}
+
+// allow checks if a viewer can use a command and if so remembers the use
+func (c *cooldowns) allow(cmd *command.Command, userPublicId, role string) bool {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	now := time.Now()
+	if !cmd.ModBypass || !moderation.IsModerator(role) {
+		cooldown := cmd.Cooldown
+		if cmd.Throttle == 0 && cmd.Cooldown == 0 && cmd.UserCooldown == 0 {
+			cooldown = command.DefaultCooldown
+		}
+
+		if last, ok := c.Last[cmd.Name]; ok {
+			if now.Sub(last.Time) < time.Duration(cooldown)*time.Second {
+				return false
+			}
+			if cmd.Throttle > 0 && c.Lines-last.Line <= cmd.Throttle {
+				return false
+			}
+		}
+
+		if last, ok := c.Viewers[cmd.Name][userPublicId]; ok && now.Sub(last) < time.Duration(cmd.UserCooldown)*time.Second {
+			return false
+		}
+	}
+
+	c.Last[cmd.Name] = commandUse{Time: now, Line: c.Lines}
+	if cmd.UserCooldown > 0 && len(userPublicId) > 0 {
+		viewers, ok := c.Viewers[cmd.Name]
+		if !ok {
+			viewers = map[string]time.Time{}
+			c.Viewers[cmd.Name] = viewers
+		}
+		if len(viewers) >= maxCooldownViewers {
+			for id, t := range viewers {
+				if now.Sub(t) >= time.Duration(cmd.UserCooldown)*time.Second {
+					delete(viewers, id)
+				}
+			}
+		}
+		viewers[userPublicId] = now
+	}
+
+	return true
+}
+
+// load loads the cooldowns saved by save
+func (c *cooldowns) load(botBucket []byte) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	err := db.DB.View(func(tx *bolt.Tx) error {
+		bkt, err := buckets.Cooldowns(tx, botBucket)
+		if err == buckets.ErrBucketNotFound {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		b := bkt.Get(cooldownsKey)
+		if b == nil {
+			return nil
+		}
+		return json.Unmarshal(b, c)
+	})
+	if c.Last == nil {
+		c.Last = map[string]commandUse{}
+	}
+	if c.Viewers == nil {
+		c.Viewers = map[string]map[string]time.Time{}
+	}
+	if err != nil {
+		log.Printf("msg='error-loading-cooldowns', error='%v', botBucket='%s'\n", err, string(botBucket))
+	}
+}
+
+// save saves the cooldowns so they can be loaded when the bot is started again
+func (c *cooldowns) save(botBucket []byte) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	err := db.DB.Update(func(tx *bolt.Tx) error {
+		b, err := json.Marshal(c)
+		if err != nil {
+			return err
+		}
+
+		bkt, err := buckets.Cooldowns(tx, botBucket)
+		if err != nil {
+			return err
+		}
+		return bkt.Put(cooldownsKey, b)
+	})
+	if err != nil {
+		log.Printf("msg='error-saving-cooldowns', error='%v', botBucket='%s'\n", err, string(botBucket))
+	}
+}
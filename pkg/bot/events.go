@@ -0,0 +1,58 @@
+package bot
+
+import (
+	"sync"
+
+	"github.com/StreamMeBots/meep/pkg/giveaways"
+	"github.com/StreamMeBots/meep/pkg/polls"
+	"github.com/StreamMeBots/meep/pkg/predictions"
+)
+
+// Event types the bot sends down the log stream along with the chat events
+type (
+	EventPoll       *polls.Poll             // a poll started, got a vote or ended
+	EventGiveaway   *giveaways.Giveaway     // a giveaway started, got an entry, a winner was drawn or it ended
+	EventPrediction *predictions.Prediction // a prediction opened, got a bet, was locked or ended
+)
+
+// events sends the bot's own events to the log stream subscribers
+type events struct {
+	mx   sync.Mutex
+	subs map[string]chan interface{}
+}
+
+func newEvents() *events {
+	return &events{subs: map[string]chan interface{}{}}
+}
+
+func (e *events) subscribe(id string) chan interface{} {
+	e.mx.Lock()
+	defer e.mx.Unlock()
+
+	c := make(chan interface{}, 10)
+	e.subs[id] = c
+	return c
+}
+
+func (e *events) unsubscribe(id string) {
+	e.mx.Lock()
+	defer e.mx.Unlock()
+
+	if c, ok := e.subs[id]; ok {
+		close(c)
+	}
+	delete(e.subs, id)
+}
+
+// emit sends the event to the subscribers, subscribers that aren't keeping up miss the event
+func (e *events) emit(ev interface{}) {
+	e.mx.Lock()
+	defer e.mx.Unlock()
+
+	for _, c := range e.subs {
+		select {
+		case c <- ev:
+		default:
+		}
+	}
+}
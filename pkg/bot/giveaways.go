@@ -0,0 +1,276 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/StreamMeBots/meep/pkg/giveaways"
+	"github.com/StreamMeBots/meep/pkg/greetings"
+	"github.com/StreamMeBots/meep/pkg/points"
+	"github.com/StreamMeBots/pkg/commands"
+)
+
+// GiveawaySaveInterval is how often the entries of the running giveaway are saved
+var GiveawaySaveInterval = 5 * time.Second
+
+// activeGiveaway is the bot's running giveaway, a bot runs one giveaway at a time
+type activeGiveaway struct {
+	mx       sync.Mutex
+	giveaway *giveaways.Giveaway
+	unsaved  bool // viewers entered since the entries were saved
+}
+
+func (a *activeGiveaway) get() *giveaways.Giveaway {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+	return a.giveaway
+}
+
+// entered marks the giveaway's entries as unsaved
+func (a *activeGiveaway) entered() {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+	a.unsaved = true
+}
+
+// resume runs the giveaway that hadn't ended when the bot stopped
+func (a *activeGiveaway) resume(botBucket []byte) {
+	g, err := giveaways.Active(botBucket)
+	if err != nil {
+		return
+	}
+
+	a.mx.Lock()
+	defer a.mx.Unlock()
+	a.giveaway = g
+}
+
+// save saves the running giveaway if viewers entered since it was saved
+func (a *activeGiveaway) save(botBucket []byte) {
+	a.mx.Lock()
+	g := a.giveaway
+	if g == nil || !a.unsaved {
+		a.mx.Unlock()
+		return
+	}
+	a.unsaved = false
+	a.mx.Unlock()
+
+	if err := g.Save(botBucket); err != nil {
+		a.entered()
+	}
+}
+
+// startGiveawaySaving saves the running giveaway's new entries every GiveawaySaveInterval and when the bot stops
+func (b *Bot) startGiveawaySaving() {
+	ticker := time.NewTicker(GiveawaySaveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-b.stop:
+			b.giveaway.save(b.bucketKey())
+			return
+		case <-ticker.C:
+			b.giveaway.save(b.bucketKey())
+		}
+	}
+}
+
+// running gets the bot of a user that is running
+func (bs *Bots) running(userPublicId string) (Bot, error) {
+	bs.RLock()
+	defer bs.RUnlock()
+
+	b, ok := bs.bots[userPublicId]
+	if !ok {
+		return b, ErrBotNotRunning
+	}
+	return b, nil
+}
+
+// StartGiveaway starts a giveaway in a user's chat
+func (bs *Bots) StartGiveaway(userPublicId string, g *giveaways.Giveaway) error {
+	b, err := bs.running(userPublicId)
+	if err != nil {
+		return err
+	}
+	return b.startGiveaway(g)
+}
+
+// DrawGiveaway draws a winner of the giveaway running in a user's chat
+func (bs *Bots) DrawGiveaway(userPublicId string, redraw bool) (*giveaways.Winner, error) {
+	b, err := bs.running(userPublicId)
+	if err != nil {
+		return nil, err
+	}
+	return b.drawGiveaway(redraw)
+}
+
+// EndGiveaway ends the giveaway running in a user's chat
+func (bs *Bots) EndGiveaway(userPublicId string) error {
+	b, err := bs.running(userPublicId)
+	if err != nil {
+		return err
+	}
+	return b.endGiveaway()
+}
+
+// ActiveGiveaway gets the giveaway running in a user's chat
+func (bs *Bots) ActiveGiveaway(userPublicId string) (*giveaways.Giveaway, error) {
+	b, err := bs.running(userPublicId)
+	if err != nil {
+		return nil, err
+	}
+
+	g := b.giveaway.get()
+	if g == nil {
+		return nil, ErrNoGiveaway
+	}
+	return g.Snapshot(), nil
+}
+
+// startGiveaway saves the giveaway and announces how to enter
+func (b *Bot) startGiveaway(g *giveaways.Giveaway) error {
+	b.giveaway.mx.Lock()
+	defer b.giveaway.mx.Unlock()
+
+	if b.giveaway.giveaway != nil {
+		return ErrGiveawayRunning
+	}
+	if err := g.Start(b.bucketKey()); err != nil {
+		return err
+	}
+	b.giveaway.giveaway = g
+
+	msg := fmt.Sprintf("A giveaway has started! Type %s to enter", g.Keyword)
+	if len(g.Prize) > 0 {
+		msg = fmt.Sprintf("A giveaway for %s has started! Type %s to enter", g.Prize, g.Keyword)
+	}
+	b.bot.Say(msg)
+	b.events.emit(EventGiveaway(g.Snapshot()))
+	return nil
+}
+
+// drawGiveaway draws and announces a winner
+func (b *Bot) drawGiveaway(redraw bool) (*giveaways.Winner, error) {
+	g := b.giveaway.get()
+	if g == nil {
+		return nil, ErrNoGiveaway
+	}
+
+	w, err := g.Draw(b.bucketKey(), redraw)
+	if err != nil {
+		return nil, err
+	}
+
+	b.bot.Say(fmt.Sprintf("Congratulations @%s, you won the giveaway!", w.Username))
+	b.events.emit(EventGiveaway(g.Snapshot()))
+	return w, nil
+}
+
+// endGiveaway ends the giveaway so another can be started
+func (b *Bot) endGiveaway() error {
+	b.giveaway.mx.Lock()
+	defer b.giveaway.mx.Unlock()
+
+	g := b.giveaway.giveaway
+	if g == nil {
+		return ErrNoGiveaway
+	}
+	if err := g.End(b.bucketKey()); err != nil {
+		return err
+	}
+	b.giveaway.giveaway = nil
+
+	b.events.emit(EventGiveaway(g.Snapshot()))
+	return nil
+}
+
+// enterGiveaway enters the viewer if the message is the giveaway's keyword. false is returned if the message isn't
+// the keyword.
+func (b *Bot) enterGiveaway(cmd *commands.Command) bool {
+	g := b.giveaway.get()
+	if g == nil {
+		return false
+	}
+
+	s := g.Snapshot()
+	if s.State != giveaways.StateOpen || !strings.EqualFold(strings.TrimSpace(cmd.Get("message")), s.Keyword) {
+		return false
+	}
+
+	streak := 0
+	if s.MinStreak > 0 || s.Weighted {
+		if v, err := greetings.GetViewer(b.bucketKey(), cmd.Get("publicId")); err == nil {
+			streak = v.DaysInARow
+		}
+	}
+
+	var balance int64
+	if s.MinPoints > 0 {
+		if a, err := points.GetAccount(b.bucketKey(), cmd.Get("publicId")); err == nil {
+			balance = a.Balance
+		}
+	}
+
+	err := g.Enter(cmd.Get("publicId"), cmd.Get("username"), cmd.Get("role"), streak, balance)
+	if err == nil {
+		b.giveaway.entered()
+		b.events.emit(EventGiveaway(g.Snapshot()))
+	}
+	return true
+}
+
+// giveawayCommand: !giveaway start [keyword] [prize], !giveaway close, !giveaway draw, !giveaway redraw and
+// !giveaway end
+func (b *Bot) giveawayCommand(cmd *commands.Command, args []string) string {
+	usage := "Usage: !giveaway start [keyword] [prize], !giveaway close, !giveaway draw, !giveaway redraw or !giveaway end"
+	if len(args) == 0 {
+		return usage
+	}
+
+	var err error
+	switch args[0] {
+	case "start":
+		g := &giveaways.Giveaway{CreatedBy: cmd.Get("username")}
+		if len(args) > 1 {
+			g.Keyword = args[1]
+			g.Prize = afterFields(cmd.Get("message"), 3)
+		}
+		if err := g.Validate(); err != nil {
+			return err.Error()
+		}
+		err = b.startGiveaway(g)
+	case "close":
+		g := b.giveaway.get()
+		if g == nil {
+			return ErrNoGiveaway.Error()
+		}
+		if err = g.Close(b.bucketKey()); err == nil {
+			s := g.Snapshot()
+			b.events.emit(EventGiveaway(s))
+			return fmt.Sprintf("The giveaway is closed with %d entries", len(s.Entries))
+		}
+	case "draw", "redraw":
+		_, err = b.drawGiveaway(args[0] == "redraw")
+	case "end":
+		if err = b.endGiveaway(); err == nil {
+			return "The giveaway has ended"
+		}
+	default:
+		return usage
+	}
+
+	switch err {
+	case nil:
+		return ""
+	case ErrGiveawayRunning, ErrNoGiveaway, giveaways.ErrNoEntries:
+		return err.Error()
+	}
+	log.Printf("msg='error-running-giveaway-command', userPublicId='%s', error='%v'\n", b.UserPublicId, err)
+	return "Something went wrong, try again"
+}
@@ -0,0 +1,348 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/StreamMeBots/meep/pkg/command"
+	"github.com/StreamMeBots/meep/pkg/greetings"
+	"github.com/StreamMeBots/meep/pkg/moderation"
+	"github.com/StreamMeBots/pkg/commands"
+)
+
+// builtinCommand is a chat command built into the bot. args are the words after the command name and the returned
+// message is said in chat.
+type builtinCommand func(b *Bot, cmd *commands.Command, args []string) string
+
+// modCommands are the built in commands that only moderators can use
+var modCommands = map[string]builtinCommand{
+	"!timeout": (*Bot).timeoutCommand,
+	"!ban":     (*Bot).banCommand,
+	"!unban":   (*Bot).unbanCommand,
+	"!mute":    (*Bot).muteCommand,
+	"!unmute":  (*Bot).unmuteCommand,
+	"!kick":    (*Bot).kickCommand,
+	"!mod":     (*Bot).modUserCommand,
+	"!erase":   (*Bot).eraseCommand,
+	"!strike":  (*Bot).strikeCommand,
+
+	// custom command management
+	"!addcom":    (*Bot).addComCommand,
+	"!editcom":   (*Bot).editComCommand,
+	"!renamecom": (*Bot).renameComCommand,
+	"!delcom":    (*Bot).delComCommand,
+	"!commands":  (*Bot).commandsCommand,
+
+	// variables
+	"!setvar": (*Bot).setVarCommand,
+	"!delvar": (*Bot).delVarCommand,
+
+	// polls and giveaways
+	"!poll":     (*Bot).pollCommand,
+	"!giveaway": (*Bot).giveawayCommand,
+
+	// predictions
+	"!prediction": (*Bot).predictionCommand,
+
+	// points
+	"!addpoints": (*Bot).addPointsCommand,
+}
+
+// chatCommands are the built in commands that everyone can use, they check for moderators themselves when needed
+var chatCommands = map[string]builtinCommand{
+	"!quote": (*Bot).quoteCommand,
+	"!vote":  (*Bot).voteCommand,
+
+	// points
+	"!points": (*Bot).pointsCommand,
+	"!give":   (*Bot).giveCommand,
+	"!top":    (*Bot).topCommand,
+	"!bet":    (*Bot).betCommand,
+
+	// trivia
+	"!trivia": (*Bot).triviaCommand,
+}
+
+// chatCooldowns rate limit the chat commands like custom commands so viewers can't make the bot flood chat. !vote
+// and !bet aren't limited, every viewer uses them at the same time and they're quiet when they work.
+var chatCooldowns = map[string]*command.Command{
+	"!quote":  {Name: "!quote", Cooldown: 5, ModBypass: true},
+	"!points": {Name: "!points", UserCooldown: 30},
+	"!give":   {Name: "!give", UserCooldown: 5},
+	"!top":    {Name: "!top", Cooldown: 10, ModBypass: true},
+	"!trivia": {Name: "!trivia", Cooldown: 10, ModBypass: true},
+}
+
+// MaxRecentMessages is the number of message ids remembered for each viewer so they can be erased
+var MaxRecentMessages = 10
+
+// recentMessages remembers the ids of the viewers' latest messages
+type recentMessages struct {
+	mx  sync.Mutex
+	ids map[string][]string
+}
+
+func newRecentMessages() *recentMessages {
+	return &recentMessages{ids: map[string][]string{}}
+}
+
+// add remembers a viewer's message
+func (r *recentMessages) add(userPublicId, messageId string) {
+	if len(userPublicId) == 0 || len(messageId) == 0 {
+		return
+	}
+
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	ids := append(r.ids[userPublicId], messageId)
+	if len(ids) > MaxRecentMessages {
+		ids = ids[len(ids)-MaxRecentMessages:]
+	}
+	r.ids[userPublicId] = ids
+}
+
+// take returns and forgets a viewer's remembered messages
+func (r *recentMessages) take(userPublicId string) []string {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	ids := r.ids[userPublicId]
+	delete(r.ids, userPublicId)
+	return ids
+}
+
+// viewerRoles remembers the chat role each viewer was last seen with, moderation actions like muting are different
+// for guests
+type viewerRoles struct {
+	mx    sync.Mutex
+	roles map[string]string
+	bot   string // the bot's own public id, learned from the messages it says
+}
+
+func newViewerRoles() *viewerRoles {
+	return &viewerRoles{roles: map[string]string{}}
+}
+
+// seen remembers the role of a viewer that joined or chatted
+func (v *viewerRoles) seen(userPublicId, role string) {
+	if len(userPublicId) == 0 || len(role) == 0 {
+		return
+	}
+
+	v.mx.Lock()
+	defer v.mx.Unlock()
+	v.roles[userPublicId] = role
+}
+
+// get gets a viewer's role, empty if the viewer hasn't been seen
+func (v *viewerRoles) get(userPublicId string) string {
+	v.mx.Lock()
+	defer v.mx.Unlock()
+	return v.roles[userPublicId]
+}
+
+// seenBot remembers the bot's own public id
+func (v *viewerRoles) seenBot(userPublicId string) {
+	if len(userPublicId) == 0 {
+		return
+	}
+
+	v.mx.Lock()
+	defer v.mx.Unlock()
+	v.bot = userPublicId
+}
+
+// protected checks if a viewer was seen as a moderator or is the bot
+func (v *viewerRoles) protected(userPublicId string) bool {
+	v.mx.Lock()
+	defer v.mx.Unlock()
+	return userPublicId == v.bot || moderation.IsModerator(v.roles[userPublicId])
+}
+
+// runBuiltinCommand runs a built in command. false is returned if the message is not a built in command or the viewer
+// can't use it.
+func (b *Bot) runBuiltinCommand(cmd *commands.Command) bool {
+	fields := strings.Fields(cmd.Get("message"))
+	if len(fields) == 0 {
+		return false
+	}
+
+	name := strings.ToLower(fields[0])
+	mc, ok := chatCommands[name]
+	if !ok {
+		mc, ok = modCommands[name]
+		if !ok || !moderation.IsModerator(cmd.Get("role")) {
+			return false
+		}
+	}
+
+	if c, ok := chatCooldowns[name]; ok && !b.cooldowns.allow(c, cmd.Get("publicId"), cmd.Get("role")) {
+		return true
+	}
+
+	if msg := mc(b, cmd, fields[1:]); len(msg) > 0 {
+		b.bot.Say(msg)
+	}
+	return true
+}
+
+// findViewer resolves a username to a viewer the bot has seen
+func (b *Bot) findViewer(username string) (*greetings.Event, string) {
+	e, err := greetings.FindViewer(b.bucketKey(), username)
+	if err == greetings.ErrViewerNotFound {
+		return nil, fmt.Sprintf("I don't know who %s is", username)
+	} else if err != nil {
+		return nil, "Something went wrong, try again"
+	}
+	return e, ""
+}
+
+// viewerCommand is a helper for the commands that take an action on a viewer: !command <user>
+func (b *Bot) viewerCommand(args []string, usage string, action func(*greetings.Event) error, done string) string {
+	if len(args) < 1 {
+		return "Usage: " + usage
+	}
+
+	v, msg := b.findViewer(args[0])
+	if v == nil {
+		return msg
+	}
+
+	if err := action(v); err == ErrProtectedViewer {
+		return fmt.Sprintf("%s can't be moderated", v.Username)
+	} else if err != nil {
+		log.Printf("msg='error-running-moderator-command', userPublicId='%s', command='%s', error='%v'\n", b.UserPublicId, usage, err)
+		return "Something went wrong, try again"
+	}
+
+	return fmt.Sprintf(done, v.Username)
+}
+
+// protected checks if a viewer is the streamer, a moderator or the bot
+func (b *Bot) protected(userPublicId string) bool {
+	return userPublicId == b.UserPublicId || b.roles.protected(userPublicId)
+}
+
+// punish wraps the action of a viewerCommand that punishes the viewer so it can't be used on the streamer, moderators
+// or the bot
+func (b *Bot) punish(action func(*greetings.Event) error) func(*greetings.Event) error {
+	return func(v *greetings.Event) error {
+		if b.protected(v.PublicID) {
+			return ErrProtectedViewer
+		}
+		return action(v)
+	}
+}
+
+// banCommand: !ban <user>
+func (b *Bot) banCommand(cmd *commands.Command, args []string) string {
+	return b.viewerCommand(args, "!ban <user>", b.punish(func(v *greetings.Event) error {
+		return b.bot.Ban(v.PublicID)
+	}), "%s has been banned")
+}
+
+// unbanCommand: !unban <user>
+func (b *Bot) unbanCommand(cmd *commands.Command, args []string) string {
+	return b.viewerCommand(args, "!unban <user>", func(v *greetings.Event) error {
+		// unbanning changes the viewer's role back to user, the same as unmuting
+		return b.bot.UnMute(v.PublicID)
+	}, "%s has been unbanned")
+}
+
+// muteCommand: !mute <user>
+func (b *Bot) muteCommand(cmd *commands.Command, args []string) string {
+	return b.viewerCommand(args, "!mute <user>", b.punish(func(v *greetings.Event) error {
+		return b.bot.Mute(v.PublicID)
+	}), "%s has been muted")
+}
+
+// unmuteCommand: !unmute <user>
+func (b *Bot) unmuteCommand(cmd *commands.Command, args []string) string {
+	return b.viewerCommand(args, "!unmute <user>", func(v *greetings.Event) error {
+		// end any timeout so the scheduler doesn't try to unmute the viewer again
+		err := b.cancelTimeout(v.PublicID)
+		if err == moderation.ErrTimeoutNotFound {
+			return moderation.UnMute(b.bot, v.PublicID, b.roles.get(v.PublicID))
+		}
+		return err
+	}, "%s has been unmuted")
+}
+
+// kickCommand: !kick <user>
+func (b *Bot) kickCommand(cmd *commands.Command, args []string) string {
+	return b.viewerCommand(args, "!kick <user>", b.punish(func(v *greetings.Event) error {
+		return b.bot.Kick(v.PublicID)
+	}), "%s has been kicked")
+}
+
+// modUserCommand: !mod <user>
+func (b *Bot) modUserCommand(cmd *commands.Command, args []string) string {
+	return b.viewerCommand(args, "!mod <user>", func(v *greetings.Event) error {
+		return b.bot.Mod(v.PublicID)
+	}, "%s is now a moderator")
+}
+
+// eraseCommand: !erase <user> erases the viewer's recent messages
+func (b *Bot) eraseCommand(cmd *commands.Command, args []string) string {
+	return b.viewerCommand(args, "!erase <user>", func(v *greetings.Event) error {
+		for _, id := range b.recent.take(v.PublicID) {
+			if err := b.bot.Erase(id); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, "%s's recent messages have been erased")
+}
+
+// strikeCommand: !strike <user> [reason]
+func (b *Bot) strikeCommand(cmd *commands.Command, args []string) string {
+	return b.viewerCommand(args, "!strike <user> [reason]", b.punish(func(v *greetings.Event) error {
+		_, err := moderation.AddStrike(b.bucketKey(), b.bot, moderation.Offense{
+			UserPublicId: v.PublicID,
+			Username:     v.Username,
+			Role:         b.roles.get(v.PublicID),
+			Reason:       strings.Join(args[1:], " "),
+			Source:       "moderator:" + cmd.Get("username"),
+		})
+		return err
+	}), "%s has been given a strike")
+}
+
+// timeoutCommand: !timeout <user> <duration>
+func (b *Bot) timeoutCommand(cmd *commands.Command, args []string) string {
+	if len(args) < 2 {
+		return "Usage: !timeout <user> <duration>"
+	}
+
+	d, err := moderation.ParseDuration(args[1])
+	if err != nil {
+		return err.Error()
+	}
+
+	v, msg := b.findViewer(args[0])
+	if v == nil {
+		return msg
+	}
+	if b.protected(v.PublicID) {
+		return fmt.Sprintf("%s can't be moderated", v.Username)
+	}
+
+	err = b.timeout(&moderation.Timeout{
+		UserPublicId: v.PublicID,
+		Username:     v.Username,
+		Role:         b.roles.get(v.PublicID),
+		By:           cmd.Get("username"),
+		Created:      time.Now(),
+		Expires:      time.Now().Add(d),
+	})
+	if err != nil {
+		log.Printf("msg='error-timing-out-viewer', userPublicId='%s', error='%v'\n", b.UserPublicId, err)
+		return "Something went wrong, try again"
+	}
+
+	return fmt.Sprintf("%s has been timed out for %v", v.Username, d)
+}
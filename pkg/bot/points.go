@@ -0,0 +1,274 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/StreamMeBots/meep/pkg/greetings"
+	"github.com/StreamMeBots/meep/pkg/points"
+	"github.com/StreamMeBots/pkg/commands"
+)
+
+// TopPoints is the number of viewers !top and !trivia top list
+var TopPoints = 5
+
+// presence keeps track of the viewers in chat so they can be given points for the time they spend there
+type presence struct {
+	mx      sync.Mutex
+	viewers map[string]*present
+}
+
+type present struct {
+	username    string
+	lastMessage time.Time // the last message that was given points
+}
+
+func newPresence() *presence {
+	return &presence{viewers: map[string]*present{}}
+}
+
+// seen adds a viewer that joined or chatted
+func (p *presence) seen(userPublicId, username string) *present {
+	v, ok := p.viewers[userPublicId]
+	if !ok {
+		v = &present{}
+		p.viewers[userPublicId] = v
+	}
+	if len(username) > 0 {
+		v.username = username
+	}
+	return v
+}
+
+func (p *presence) join(userPublicId, username string) {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+	p.seen(userPublicId, username)
+}
+
+func (p *presence) leave(userPublicId string) {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+	delete(p.viewers, userPublicId)
+}
+
+// message adds the viewer and reports if their message should be given points
+func (p *presence) message(userPublicId, username string, cooldown time.Duration) bool {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+
+	v := p.seen(userPublicId, username)
+	if time.Since(v.lastMessage) < cooldown {
+		return false
+	}
+	v.lastMessage = time.Now()
+	return true
+}
+
+// changes gives each viewer in chat amount points
+func (p *presence) changes(amount int64, reason string) []points.Change {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+
+	changes := make([]points.Change, 0, len(p.viewers))
+	for id, v := range p.viewers {
+		changes = append(changes, points.Change{
+			UserPublicId: id,
+			Username:     v.username,
+			Amount:       amount,
+			Reason:       reason,
+		})
+	}
+	return changes
+}
+
+// pointsSettings gets the bot's points settings, nil is returned if points are turned off
+func (b *Bot) pointsSettings() *points.Settings {
+	s, err := points.GetSettings(b.bucketKey())
+	if err != nil || !s.Enabled {
+		return nil
+	}
+	return s
+}
+
+// startPoints gives the viewers in chat points every minute until the bot stops
+func (b *Bot) startPoints() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-b.stop:
+			return
+		case <-ticker.C:
+		}
+
+		s := b.pointsSettings()
+		if s == nil || s.PerMinute == 0 {
+			continue
+		}
+
+		if changes := b.presence.changes(s.PerMinute, points.ReasonPresence); len(changes) > 0 {
+			points.Apply(b.bucketKey(), changes...)
+		}
+	}
+}
+
+// messagePoints gives a viewer points for chatting
+func (b *Bot) messagePoints(cmd *commands.Command) {
+	if cmd.Get("bot") == "true" {
+		return
+	}
+
+	s := b.pointsSettings()
+	if s == nil || s.PerMessage == 0 {
+		b.presence.join(cmd.Get("publicId"), cmd.Get("username"))
+		return
+	}
+
+	if b.presence.message(cmd.Get("publicId"), cmd.Get("username"), time.Duration(s.MessageCooldown)*time.Second) {
+		points.Apply(b.bucketKey(), points.Change{
+			UserPublicId: cmd.Get("publicId"),
+			Username:     cmd.Get("username"),
+			Amount:       s.PerMessage,
+			Reason:       points.ReasonMessage,
+		})
+	}
+}
+
+// streakPoints gives a viewer that visited days in a row the streak bonus
+func (b *Bot) streakPoints(e greetings.Event) {
+	if !e.Consecutive() {
+		return
+	}
+
+	s := b.pointsSettings()
+	if s == nil || s.StreakBonus == 0 {
+		return
+	}
+
+	points.Apply(b.bucketKey(), points.Change{
+		UserPublicId: e.PublicID,
+		Username:     e.Username,
+		Amount:       s.Streak(e.DaysInARow),
+		Reason:       points.ReasonStreak,
+		Note:         fmt.Sprintf("%d days in a row", e.DaysInARow),
+	})
+}
+
+// pointsCommand: !points [user]
+func (b *Bot) pointsCommand(cmd *commands.Command, args []string) string {
+	s := b.pointsSettings()
+	if s == nil {
+		return ""
+	}
+
+	id, username := cmd.Get("publicId"), cmd.Get("username")
+	if len(args) > 0 {
+		v, msg := b.findViewer(args[0])
+		if v == nil {
+			return msg
+		}
+		id, username = v.PublicID, v.Username
+	}
+
+	a, err := points.GetAccount(b.bucketKey(), id)
+	if err != nil {
+		return "Something went wrong, try again"
+	}
+	return fmt.Sprintf("%s has %d %s", username, a.Balance, s.Currency)
+}
+
+// giveCommand: !give <user> <amount>
+func (b *Bot) giveCommand(cmd *commands.Command, args []string) string {
+	s := b.pointsSettings()
+	if s == nil {
+		return ""
+	}
+
+	if len(args) < 2 {
+		return "Usage: !give <user> <amount>"
+	}
+	amount, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return "Usage: !give <user> <amount>"
+	}
+
+	v, msg := b.findViewer(args[0])
+	if v == nil {
+		return msg
+	}
+
+	from := points.Account{UserPublicId: cmd.Get("publicId"), Username: cmd.Get("username")}
+	to := points.Account{UserPublicId: v.PublicID, Username: v.Username}
+	balance, err := points.Transfer(b.bucketKey(), from, to, amount)
+	switch err {
+	case nil:
+		return fmt.Sprintf("%s gave %d %s to %s, they have %d left", from.Username, amount, s.Currency, to.Username, balance)
+	case points.ErrInsufficientPoints:
+		return fmt.Sprintf("@%s you don't have enough %s", from.Username, s.Currency)
+	case points.ErrInvalidAmount, points.ErrSameAccount:
+		return err.Error()
+	}
+	return "Something went wrong, try again"
+}
+
+// topCommand: !top
+func (b *Bot) topCommand(cmd *commands.Command, args []string) string {
+	s := b.pointsSettings()
+	if s == nil {
+		return ""
+	}
+
+	accounts, err := points.GetAccounts(b.bucketKey(), TopPoints)
+	if err != nil {
+		return "Something went wrong, try again"
+	}
+	if len(accounts) == 0 {
+		return fmt.Sprintf("Nobody has any %s yet", s.Currency)
+	}
+
+	top := make([]string, len(accounts))
+	for i, a := range accounts {
+		top[i] = fmt.Sprintf("%d. %s (%d)", i+1, a.Username, a.Balance)
+	}
+	return fmt.Sprintf("Top %s: %s", s.Currency, strings.Join(top, ", "))
+}
+
+// addPointsCommand: !addpoints <user> <amount>, a negative amount takes points away
+func (b *Bot) addPointsCommand(cmd *commands.Command, args []string) string {
+	s := b.pointsSettings()
+	if s == nil {
+		return ErrPointsOff.Error()
+	}
+
+	if len(args) < 2 {
+		return "Usage: !addpoints <user> <amount>"
+	}
+	amount, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil || amount == 0 {
+		return "Usage: !addpoints <user> <amount>"
+	}
+
+	v, msg := b.findViewer(args[0])
+	if v == nil {
+		return msg
+	}
+
+	balances, err := points.Apply(b.bucketKey(), points.Change{
+		UserPublicId: v.PublicID,
+		Username:     v.Username,
+		Amount:       amount,
+		Reason:       points.ReasonAdjust,
+		Note:         cmd.Get("username"),
+	})
+	if err != nil {
+		log.Printf("msg='error-adding-points', userPublicId='%s', error='%v'\n", b.UserPublicId, err)
+		return "Something went wrong, try again"
+	}
+	return fmt.Sprintf("%s now has %d %s", v.Username, balances[0], s.Currency)
+}
@@ -0,0 +1,194 @@
+package bot
+
+import (
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/StreamMeBots/meep/pkg/moderation"
+	"github.com/StreamMeBots/meep/pkg/polls"
+	"github.com/StreamMeBots/pkg/commands"
+)
+
+// activePoll is the bot's running poll, a bot runs one poll at a time
+type activePoll struct {
+	mx   sync.Mutex
+	poll *polls.Poll
+	end  chan struct{} // closed to end the poll early
+}
+
+func (a *activePoll) get() *polls.Poll {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+	return a.poll
+}
+
+// StartPoll starts a poll in a user's chat
+func (bs *Bots) StartPoll(userPublicId string, p *polls.Poll) error {
+	bs.RLock()
+	b, ok := bs.bots[userPublicId]
+	bs.RUnlock()
+	if !ok {
+		return ErrBotNotRunning
+	}
+
+	return b.startPoll(p)
+}
+
+// ActivePoll gets the poll running in a user's chat
+func (bs *Bots) ActivePoll(userPublicId string) (*polls.Poll, error) {
+	bs.RLock()
+	b, ok := bs.bots[userPublicId]
+	bs.RUnlock()
+	if !ok {
+		return nil, ErrBotNotRunning
+	}
+
+	p := b.poll.get()
+	if p == nil {
+		return nil, ErrNoPollRunning
+	}
+	return p.Snapshot(), nil
+}
+
+// startPoll announces the poll and ends it when its duration is over
+func (b *Bot) startPoll(p *polls.Poll) error {
+	b.poll.mx.Lock()
+	if b.poll.poll != nil {
+		b.poll.mx.Unlock()
+		return ErrPollRunning
+	}
+	p.Start()
+	end := make(chan struct{})
+	b.poll.poll, b.poll.end = p, end
+	b.poll.mx.Unlock()
+
+	b.bot.Say(p.Announcement())
+	b.events.emit(EventPoll(p.Snapshot()))
+
+	b.tasks.run(func() {
+		timer := time.NewTimer(p.Ends.Sub(time.Now()))
+		defer timer.Stop()
+
+		announce := true
+		select {
+		case <-timer.C:
+		case <-end:
+		case <-b.stop:
+			announce = false
+		}
+		b.endPoll(p, announce)
+	})
+
+	return nil
+}
+
+// endPoll saves the poll's results and announces them
+func (b *Bot) endPoll(p *polls.Poll, announce bool) {
+	p.End()
+	if err := p.Save(b.bucketKey()); err != nil {
+		log.Printf("msg='error-saving-poll', userPublicId='%s', error='%v'\n", b.UserPublicId, err)
+	}
+
+	b.poll.mx.Lock()
+	if b.poll.poll == p {
+		b.poll.poll, b.poll.end = nil, nil
+	}
+	b.poll.mx.Unlock()
+
+	b.events.emit(EventPoll(p.Snapshot()))
+	if announce {
+		b.bot.Say(p.Results())
+	}
+}
+
+// pollCommand: !poll [duration] "Question" opt1 | opt2 | opt3, or !poll end to end the poll early
+func (b *Bot) pollCommand(cmd *commands.Command, args []string) string {
+	usage := `Usage: !poll [duration] "Question" option 1 | option 2 | ...`
+	if len(args) == 0 {
+		return usage
+	}
+
+	if args[0] == "end" {
+		b.poll.mx.Lock()
+		end := b.poll.end
+		b.poll.end = nil
+		b.poll.mx.Unlock()
+		if end == nil {
+			return ErrNoPollRunning.Error()
+		}
+		close(end)
+		return ""
+	}
+
+	rest := afterFields(cmd.Get("message"), 1)
+	var d time.Duration
+	if len(args) > 1 && !strings.HasPrefix(args[0], `"`) {
+		if pd, err := moderation.ParseDuration(args[0]); err == nil {
+			d = pd
+			rest = afterFields(cmd.Get("message"), 2)
+		}
+	}
+
+	question, options := splitPoll(rest)
+	if len(question) == 0 {
+		return usage
+	}
+
+	p := polls.New(question, options, d, cmd.Get("username"))
+	if err := p.Validate(); err != nil {
+		return err.Error()
+	}
+	if err := b.startPoll(p); err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
+// splitPoll splits `"Question" opt1 | opt2` into the question and options. A question that is not quoted ends at the
+// first question mark.
+func splitPoll(s string) (string, []string) {
+	var question, rest string
+	if strings.HasPrefix(s, `"`) {
+		i := strings.Index(s[1:], `"`)
+		if i < 0 {
+			return "", nil
+		}
+		question, rest = s[1:i+1], s[i+2:]
+	} else {
+		i := strings.Index(s, "?")
+		if i < 0 {
+			return "", nil
+		}
+		question, rest = s[:i+1], s[i+1:]
+	}
+
+	options := []string{}
+	for _, o := range strings.Split(rest, "|") {
+		if o = strings.TrimSpace(o); len(o) > 0 {
+			options = append(options, o)
+		}
+	}
+	return strings.TrimSpace(question), options
+}
+
+// voteCommand: !vote <number>
+func (b *Bot) voteCommand(cmd *commands.Command, args []string) string {
+	p := b.poll.get()
+	if p == nil || len(args) == 0 {
+		return ""
+	}
+
+	n, err := strconv.Atoi(args[0])
+	if err != nil {
+		return ""
+	}
+
+	// voting is quiet so chat isn't flooded, the tally goes to the log stream
+	if err := p.Vote(cmd.Get("publicId"), n); err == nil {
+		b.events.emit(EventPoll(p.Snapshot()))
+	}
+	return ""
+}
@@ -0,0 +1,231 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/StreamMeBots/meep/pkg/moderation"
+	"github.com/StreamMeBots/meep/pkg/points"
+	"github.com/StreamMeBots/meep/pkg/predictions"
+	"github.com/StreamMeBots/pkg/commands"
+)
+
+// OpenPrediction opens a prediction in a user's chat
+func (bs *Bots) OpenPrediction(userPublicId string, p *predictions.Prediction) error {
+	b, err := bs.running(userPublicId)
+	if err != nil {
+		return err
+	}
+	return b.openPrediction(p)
+}
+
+// LockPrediction locks the bets of a user's running prediction. The bot doesn't need to be running so predictions
+// can still be settled after the bot stops.
+func (bs *Bots) LockPrediction(userPublicId string) (*predictions.Prediction, error) {
+	p, err := predictions.Lock([]byte(userPublicId), 0)
+	if err != nil {
+		return nil, err
+	}
+	if b, err := bs.running(userPublicId); err == nil {
+		b.announcePrediction(p)
+	}
+	return p, nil
+}
+
+// ResolvePrediction pays out a user's running prediction
+func (bs *Bots) ResolvePrediction(userPublicId string, outcome int) (*predictions.Prediction, error) {
+	p, err := predictions.Resolve([]byte(userPublicId), outcome)
+	if err != nil {
+		return nil, err
+	}
+	if b, err := bs.running(userPublicId); err == nil {
+		b.announcePrediction(p)
+	}
+	return p, nil
+}
+
+// RefundPrediction refunds a user's running prediction
+func (bs *Bots) RefundPrediction(userPublicId string) (*predictions.Prediction, error) {
+	p, err := predictions.Refund([]byte(userPublicId))
+	if err != nil {
+		return nil, err
+	}
+	if b, err := bs.running(userPublicId); err == nil {
+		b.announcePrediction(p)
+	}
+	return p, nil
+}
+
+// openPrediction saves and announces the prediction
+func (b *Bot) openPrediction(p *predictions.Prediction) error {
+	if b.pointsSettings() == nil {
+		return ErrPointsOff
+	}
+	if err := predictions.Open(b.bucketKey(), p); err != nil {
+		return err
+	}
+
+	b.announcePrediction(p)
+	b.tasks.run(func() { b.lockPrediction(p) })
+	return nil
+}
+
+// resumePrediction locks the running prediction when its window ends if the bot was restarted while it was open
+func (b *Bot) resumePrediction() {
+	if p, err := predictions.Active(b.bucketKey()); err == nil {
+		b.lockPrediction(p)
+	}
+}
+
+// lockPrediction waits for the prediction's window to end and locks the bets
+func (b *Bot) lockPrediction(p *predictions.Prediction) {
+	if p.State != predictions.StateOpen || p.Locks.IsZero() {
+		return
+	}
+
+	timer := time.NewTimer(p.Locks.Sub(time.Now()))
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-b.stop:
+		return
+	}
+
+	// the prediction may have been locked or ended already
+	if p, err := predictions.Lock(b.bucketKey(), p.Id); err == nil {
+		b.announcePrediction(p)
+	}
+}
+
+// announcePrediction tells chat and the log stream about the prediction's state
+func (b *Bot) announcePrediction(p *predictions.Prediction) {
+	currency := points.DefaultSettings.Currency
+	if s, err := points.GetSettings(b.bucketKey()); err == nil {
+		currency = s.Currency
+	}
+
+	switch p.State {
+	case predictions.StateOpen:
+		b.bot.Say(p.Announcement())
+	case predictions.StateLocked:
+		b.bot.Say(fmt.Sprintf("Bets are locked! %d %s are riding on: %s", p.Pool(), currency, p.Title))
+	case predictions.StateResolved:
+		o := p.Outcomes[p.Winner-1]
+		b.bot.Say(fmt.Sprintf("%s won! %d viewers split %d %s", o.Text, o.Bettors, p.Pool(), currency))
+	case predictions.StateRefunded:
+		b.bot.Say(fmt.Sprintf("The prediction was refunded, everyone got their %s back", currency))
+	}
+	b.events.emit(EventPrediction(p))
+}
+
+// predictionCommand: !prediction [duration] "Title" outcome 1 | outcome 2, !prediction lock,
+// !prediction resolve <outcome> and !prediction refund
+func (b *Bot) predictionCommand(cmd *commands.Command, args []string) string {
+	usage := `Usage: !prediction [duration] "Title" outcome 1 | outcome 2 | ..., !prediction lock, !prediction resolve <outcome> or !prediction refund`
+	if len(args) == 0 {
+		return usage
+	}
+
+	var err error
+	switch args[0] {
+	case "lock":
+		err = b.predictionAction(func() (*predictions.Prediction, error) {
+			return predictions.Lock(b.bucketKey(), 0)
+		})
+	case "resolve":
+		if len(args) < 2 {
+			return "Usage: !prediction resolve <outcome>"
+		}
+		err = b.predictionAction(func() (*predictions.Prediction, error) {
+			p, err := predictions.Active(b.bucketKey())
+			if err != nil {
+				return nil, err
+			}
+			return predictions.Resolve(b.bucketKey(), p.Outcome(afterFields(cmd.Get("message"), 2)))
+		})
+	case "refund":
+		err = b.predictionAction(func() (*predictions.Prediction, error) {
+			return predictions.Refund(b.bucketKey())
+		})
+	default:
+		rest := afterFields(cmd.Get("message"), 1)
+		var d time.Duration
+		if len(args) > 1 && !strings.HasPrefix(args[0], `"`) {
+			if pd, err := moderation.ParseDuration(args[0]); err == nil {
+				d = pd
+				rest = afterFields(cmd.Get("message"), 2)
+			}
+		}
+
+		title, outcomes := splitPoll(rest)
+		if len(title) == 0 {
+			return usage
+		}
+
+		p := predictions.New(title, outcomes, d, cmd.Get("username"))
+		if err := p.Validate(); err != nil {
+			return err.Error()
+		}
+		err = b.openPrediction(p)
+	}
+
+	switch err {
+	case nil:
+		return ""
+	case ErrPointsOff, predictions.ErrPredictionRunning, predictions.ErrNoPrediction, predictions.ErrLocked, predictions.ErrInvalidOutcome:
+		return err.Error()
+	}
+	log.Printf("msg='error-running-prediction-command', userPublicId='%s', error='%v'\n", b.UserPublicId, err)
+	return "Something went wrong, try again"
+}
+
+// predictionAction runs a change to the running prediction and announces it
+func (b *Bot) predictionAction(fn func() (*predictions.Prediction, error)) error {
+	p, err := fn()
+	if err != nil {
+		return err
+	}
+	b.announcePrediction(p)
+	return nil
+}
+
+// betCommand: !bet <outcome> <amount>
+func (b *Bot) betCommand(cmd *commands.Command, args []string) string {
+	s := b.pointsSettings()
+	if s == nil {
+		return ""
+	}
+
+	p, err := predictions.Active(b.bucketKey())
+	if err != nil {
+		return ""
+	}
+
+	username := cmd.Get("username")
+	if len(args) < 2 {
+		return "Usage: !bet <outcome> <amount>"
+	}
+	amount, err := strconv.ParseInt(args[len(args)-1], 10, 64)
+	if err != nil {
+		return "Usage: !bet <outcome> <amount>"
+	}
+
+	// outcomes can have spaces, the amount is always last
+	outcome := p.Outcome(strings.Join(args[:len(args)-1], " "))
+	p, err = predictions.PlaceBet(b.bucketKey(), cmd.Get("publicId"), username, outcome, amount)
+	switch err {
+	case nil:
+		// betting is quiet so chat isn't flooded, the pool goes to the log stream
+		b.events.emit(EventPrediction(p))
+		return ""
+	case points.ErrInsufficientPoints:
+		return fmt.Sprintf("@%s you don't have enough %s", username, s.Currency)
+	case predictions.ErrLocked, predictions.ErrInvalidOutcome, predictions.ErrOtherOutcome, points.ErrInvalidAmount:
+		return fmt.Sprintf("@%s %s", username, err.Error())
+	}
+	return ""
+}
@@ -0,0 +1,143 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/StreamMeBots/meep/pkg/moderation"
+	"github.com/StreamMeBots/meep/pkg/quotes"
+	"github.com/StreamMeBots/meep/pkg/user"
+	"github.com/StreamMeBots/meep/pkg/variables"
+	"github.com/StreamMeBots/pkg/commands"
+)
+
+// MaxQuoteSearchIds is the most quote ids !quote search lists, it only says one message
+var MaxQuoteSearchIds = 20
+
+// quoteCommand: !quote, !quote <id>, !quote search <word>, and for moderators !quote add <text> and
+// !quote del <id>
+func (b *Bot) quoteCommand(cmd *commands.Command, args []string) string {
+	if len(args) == 0 {
+		q, err := quotes.Random(b.bucketKey())
+		if err == quotes.ErrQuoteNotFound {
+			return "There are no quotes yet"
+		} else if err != nil {
+			return "Something went wrong, try again"
+		}
+		return b.formatQuote(q)
+	}
+
+	isMod := moderation.IsModerator(cmd.Get("role"))
+	switch args[0] {
+	case "add":
+		if !isMod {
+			return ""
+		}
+		return b.addQuote(cmd)
+	case "del", "delete":
+		if !isMod {
+			return ""
+		}
+		if len(args) < 2 {
+			return "Usage: !quote del <id>"
+		}
+		return b.deleteQuote(args[1])
+	case "search":
+		if len(args) < 2 {
+			return "Usage: !quote search <word>"
+		}
+		return b.searchQuotes(afterFields(cmd.Get("message"), 2))
+	}
+
+	id, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		return "Usage: !quote [id], !quote search <word>"
+	}
+	q, err := quotes.Get(b.bucketKey(), id)
+	if err == quotes.ErrQuoteNotFound {
+		return fmt.Sprintf("Quote #%d doesn't exist", id)
+	} else if err != nil {
+		return "Something went wrong, try again"
+	}
+	return b.formatQuote(q)
+}
+
+// formatQuote formats a quote for chat
+func (b *Bot) formatQuote(q *quotes.Quote) string {
+	msg := fmt.Sprintf("#%d: %s", q.Id, q.Text)
+	if len(q.Category) > 0 {
+		msg += " [" + q.Category + "]"
+	}
+	return msg + " (" + q.Created.In(user.Location(b.bucketKey())).Format("Jan 2, 2006") + ")"
+}
+
+// addQuote: !quote add <text>. The quote's category is the game variable if it's set.
+func (b *Bot) addQuote(cmd *commands.Command) string {
+	q := &quotes.Quote{
+		Text:    afterFields(cmd.Get("message"), 2),
+		AddedBy: cmd.Get("username"),
+	}
+	if len(q.Text) == 0 {
+		return "Usage: !quote add <text>"
+	}
+	if game, err := variables.GetVar(b.bucketKey(), "game"); err == nil {
+		q.Category = game
+	}
+
+	if err := q.Validate(); err != nil {
+		return err.Error()
+	}
+	if err := quotes.Add(b.bucketKey(), q); err != nil {
+		return "Something went wrong, try again"
+	}
+
+	return fmt.Sprintf("Quote #%d has been added", q.Id)
+}
+
+// deleteQuote: !quote del <id>
+func (b *Bot) deleteQuote(arg string) string {
+	id, err := strconv.ParseUint(arg, 10, 64)
+	if err != nil {
+		return "Usage: !quote del <id>"
+	}
+
+	err = quotes.Delete(b.bucketKey(), id)
+	if err == quotes.ErrQuoteNotFound {
+		return fmt.Sprintf("Quote #%d doesn't exist", id)
+	} else if err != nil {
+		return "Something went wrong, try again"
+	}
+
+	return fmt.Sprintf("Quote #%d has been deleted", id)
+}
+
+// searchQuotes: !quote search <word> says the quote if there's one match, otherwise the ids of the matches
+func (b *Bot) searchQuotes(word string) string {
+	qs, err := quotes.Search(b.bucketKey(), word)
+	if err != nil {
+		log.Printf("msg='error-searching-quotes', userPublicId='%s', error='%v'\n", b.UserPublicId, err)
+		return "Something went wrong, try again"
+	}
+
+	switch len(qs) {
+	case 0:
+		return fmt.Sprintf("No quotes match %s", word)
+	case 1:
+		return b.formatQuote(qs[0])
+	}
+
+	ids := []string{}
+	for _, q := range qs {
+		if len(ids) == MaxQuoteSearchIds {
+			break
+		}
+		ids = append(ids, fmt.Sprintf("#%d", q.Id))
+	}
+	msg := fmt.Sprintf("%d quotes match: %s", len(qs), strings.Join(ids, ", "))
+	if more := len(qs) - len(ids); more > 0 {
+		msg += fmt.Sprintf(" and %d more", more)
+	}
+	return msg
+}
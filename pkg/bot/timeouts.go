@@ -0,0 +1,74 @@
+package bot
+
+import (
+	"log"
+	"time"
+
+	"github.com/StreamMeBots/meep/pkg/moderation"
+)
+
+// maxTimeoutWait is the longest the timeout scheduler sleeps before checking the timeouts again
+var maxTimeoutWait = time.Minute * 10
+
+// startTimeouts unmutes viewers when their timeouts are over until the bot is stopped. Timeouts that ended while
+// the bot was not running are ended right away.
+func (b *Bot) startTimeouts() {
+	for {
+		timer := time.NewTimer(b.endTimeouts())
+
+		select {
+		case <-b.stop:
+			timer.Stop()
+			return
+		case <-b.timeouts:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// endTimeouts unmutes the viewers whose timeouts are over and returns how long until the next timeout is over
+func (b *Bot) endTimeouts() time.Duration {
+	timeouts, err := moderation.GetTimeouts(b.bucketKey())
+	if err != nil {
+		return maxTimeoutWait
+	}
+
+	wait := maxTimeoutWait
+	for _, t := range timeouts {
+		if !t.Expired() {
+			if d := t.Expires.Sub(time.Now()); d < wait {
+				wait = d
+			}
+			continue
+		}
+
+		if err := moderation.EndTimeout(b.bucketKey(), b.bot, t); err != nil {
+			log.Printf("msg='error-ending-timeout', userPublicId='%s', viewer='%s', error='%v'\n", b.UserPublicId, t.UserPublicId, err)
+		}
+	}
+
+	return wait
+}
+
+// timeout times out a viewer and lets the scheduler know about it
+func (b *Bot) timeout(t *moderation.Timeout) error {
+	if err := moderation.AddTimeout(b.bucketKey(), b.bot, t); err != nil {
+		return err
+	}
+	b.timeouts.Reload()
+	return nil
+}
+
+// cancelTimeout ends a viewer's timeout early
+func (b *Bot) cancelTimeout(userPublicId string) error {
+	t, err := moderation.GetTimeout(b.bucketKey(), userPublicId)
+	if err != nil {
+		return err
+	}
+	if err := moderation.EndTimeout(b.bucketKey(), b.bot, t); err != nil {
+		return err
+	}
+	b.timeouts.Reload()
+	return nil
+}
@@ -0,0 +1,87 @@
+package bot
+
+import (
+	"log"
+	"time"
+
+	"github.com/StreamMeBots/meep/pkg/command"
+	"github.com/StreamMeBots/pkg/commands"
+)
+
+// TimerInterval is the unit of a Command's Timer
+var TimerInterval = time.Minute
+
+// reloader is used to tell a bot's scheduler that its data changed
+type reloader chan struct{}
+
+func newReloader() reloader {
+	// buffered so a reload can be requested without blocking the caller
+	return make(reloader, 1)
+}
+
+// Reload asks the scheduler to re-read its data
+func (r reloader) Reload() {
+	select {
+	case r <- struct{}{}:
+	default:
+		// a reload is already pending
+	}
+}
+
+// timedCommand keeps track of when a command should be posted next
+type timedCommand struct {
+	cmd  *command.Command
+	next time.Time
+}
+
+// startCommandTimers runs the command timer scheduler until the bot is stopped
+func (b *Bot) startCommandTimers() {
+	timed := b.loadCommandTimers(nil)
+
+	tick := time.NewTicker(time.Second)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-b.stop:
+			return
+		case <-b.timers:
+			timed = b.loadCommandTimers(timed)
+		case now := <-tick.C:
+			for _, t := range timed {
+				if now.Before(t.next) {
+					continue
+				}
+				t.next = now.Add(time.Duration(t.cmd.Timer) * TimerInterval)
+
+				if msg := t.cmd.Parse(b.bucketKey(), &commands.Command{Args: map[string]string{}}); len(msg) > 0 {
+					b.bot.Say(msg)
+				}
+			}
+		}
+	}
+}
+
+// loadCommandTimers gets the bot's commands with timers. Commands that were already scheduled keep their next
+// post time unless their interval changed.
+func (b *Bot) loadCommandTimers(prev map[string]*timedCommand) map[string]*timedCommand {
+	cmds, err := command.GetCommandsWithTimers(b.bucketKey())
+	if err != nil {
+		log.Printf("msg='error-getting-command-timers', error='%v', userPublicId='%s'\n", err, b.UserPublicId)
+		return prev
+	}
+
+	timed := make(map[string]*timedCommand, len(cmds))
+	for _, cmd := range cmds {
+		t := &timedCommand{
+			cmd:  cmd,
+			next: time.Now().Add(time.Duration(cmd.Timer) * TimerInterval),
+		}
+		if p, ok := prev[cmd.Name]; ok && p.cmd.Timer == cmd.Timer {
+			t.next = p.next
+		}
+		timed[cmd.Name] = t
+	}
+
+	return timed
+}
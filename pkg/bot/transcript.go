@@ -0,0 +1,76 @@
+package bot
+
+import (
+	"log"
+	"time"
+
+	"github.com/StreamMeBots/meep/pkg/transcripts"
+	"github.com/StreamMeBots/meep/pkg/user"
+	pkgBot "github.com/StreamMeBots/pkg/bot"
+	"github.com/StreamMeBots/pkg/commands"
+)
+
+// chatBot is the bot's chat connection. Everything the bot says goes through Say so it's added to the transcript.
+type chatBot struct {
+	*pkgBot.Bot
+	botBucket []byte
+}
+
+// Say says msg in chat and adds it to the transcript
+func (c *chatBot) Say(msg string) error {
+	transcripts.Add(c.botBucket, &transcripts.Entry{
+		Type:    transcripts.TypeBot,
+		Message: msg,
+	})
+	return c.Bot.Say(msg)
+}
+
+// transcriptTypes are the chat commands that are added to the transcript
+var transcriptTypes = map[string]string{
+	commands.LSay:   transcripts.TypeSay,
+	commands.LJoin:  transcripts.TypeJoin,
+	commands.LLeave: transcripts.TypeLeave,
+}
+
+// record adds a chat command to the transcript
+func (b *Bot) record(cmd *commands.Command) {
+	t, ok := transcriptTypes[cmd.Name]
+	if !ok {
+		return
+	}
+	// chat sends the bot's own messages back, they were added when they were said
+	if t == transcripts.TypeSay && cmd.Get("bot") == "true" {
+		return
+	}
+
+	transcripts.Add(b.bucketKey(), &transcripts.Entry{
+		Type:         t,
+		UserPublicId: cmd.Get("publicId"),
+		Username:     cmd.Get("username"),
+		Role:         cmd.Get("role"),
+		Message:      cmd.Get("message"),
+		MessageId:    cmd.Get("messageId"),
+	})
+}
+
+// startTranscriptPruning deletes the transcript entries that are older than the user's retention setting every hour
+// until the bot stops
+func (b *Bot) startTranscriptPruning() {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		if s, err := user.GetSettings(b.bucketKey()); err == nil && s.TranscriptDays > 0 {
+			n, err := transcripts.Prune(b.bucketKey(), time.Now().AddDate(0, 0, -s.TranscriptDays))
+			if err == nil && n > 0 {
+				log.Printf("msg='pruned-transcript', userPublicId='%s', entries='%d'\n", b.UserPublicId, n)
+			}
+		}
+
+		select {
+		case <-b.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
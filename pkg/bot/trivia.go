@@ -0,0 +1,247 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/StreamMeBots/meep/pkg/moderation"
+	"github.com/StreamMeBots/meep/pkg/trivia"
+	"github.com/StreamMeBots/pkg/commands"
+)
+
+// MaxTriviaGuesses is the number of chat messages that can wait to be checked against the answer, more are dropped
+// so a busy chat never blocks the read loop
+var MaxTriviaGuesses = 50
+
+// activeTrivia is the bot's trivia game, one question is asked at a time
+type activeTrivia struct {
+	mx    sync.Mutex
+	round *triviaRound
+	last  string    // the last question asked so it isn't asked twice in a row
+	asked time.Time // when the last question was asked
+}
+
+// triviaRound is a question waiting for an answer. The round runs in its own goroutine and chat messages are sent to
+// it as guesses.
+type triviaRound struct {
+	question *trivia.Question
+	guesses  chan *commands.Command
+	end      chan struct{} // closed to end the round early
+}
+
+func (a *activeTrivia) get() *triviaRound {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+	return a.round
+}
+
+// triviaSettings gets the bot's trivia settings, nil is returned if trivia is turned off
+func (b *Bot) triviaSettings() *trivia.Settings {
+	s, err := trivia.GetSettings(b.bucketKey())
+	if err != nil || !s.Enabled {
+		return nil
+	}
+	return s
+}
+
+// startTrivia asks questions on the trivia timer until the bot stops
+func (b *Bot) startTrivia() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-b.stop:
+			return
+		case <-ticker.C:
+		}
+
+		s := b.triviaSettings()
+		if s == nil || s.Interval == 0 {
+			continue
+		}
+
+		b.trivia.mx.Lock()
+		due := time.Since(b.trivia.asked) >= time.Duration(s.Interval)*time.Minute
+		b.trivia.mx.Unlock()
+		if !due {
+			continue
+		}
+
+		if err := b.askTrivia(s); err != nil && err != ErrTriviaRunning && err != trivia.ErrNoQuestions {
+			log.Printf("msg='error-asking-trivia', userPublicId='%s', error='%v'\n", b.UserPublicId, err)
+		}
+	}
+}
+
+// askTrivia asks a question and starts the round
+func (b *Bot) askTrivia(s *trivia.Settings) error {
+	b.trivia.mx.Lock()
+	if b.trivia.round != nil {
+		b.trivia.mx.Unlock()
+		return ErrTriviaRunning
+	}
+
+	q, err := trivia.Random(b.bucketKey(), s.Packs, b.trivia.last)
+	if err != nil {
+		b.trivia.mx.Unlock()
+		return err
+	}
+
+	r := &triviaRound{
+		question: q,
+		guesses:  make(chan *commands.Command, MaxTriviaGuesses),
+		end:      make(chan struct{}),
+	}
+	b.trivia.round = r
+	b.trivia.last = q.Question
+	b.trivia.asked = time.Now()
+	b.trivia.mx.Unlock()
+
+	b.bot.Say(fmt.Sprintf("Trivia: %s (%d seconds to answer)", q.Question, s.AnswerTime))
+	b.tasks.run(func() { b.runTrivia(r, s) })
+	return nil
+}
+
+// runTrivia checks the guesses and gives hints until the question is answered or time runs out
+func (b *Bot) runTrivia(r *triviaRound, s *trivia.Settings) {
+	defer func() {
+		b.trivia.mx.Lock()
+		if b.trivia.round == r {
+			b.trivia.round = nil
+		}
+		b.trivia.mx.Unlock()
+	}()
+
+	timeUp := time.NewTimer(time.Duration(s.AnswerTime) * time.Second)
+	defer timeUp.Stop()
+	hints := time.NewTicker(s.HintEvery())
+	defer hints.Stop()
+
+	answer := r.question.Answers[0]
+	hint := 0
+	for {
+		select {
+		case cmd := <-r.guesses:
+			if trivia.Match(r.question, cmd.Get("message")) {
+				b.triviaWinner(cmd, answer, s)
+				return
+			}
+		case <-hints.C:
+			if hint < s.Hints {
+				hint++
+				b.bot.Say("Hint: " + trivia.Hint(answer, hint))
+			}
+		case <-timeUp.C:
+			b.bot.Say(fmt.Sprintf("Time's up! The answer was %s", answer))
+			return
+		case <-r.end:
+			b.bot.Say(fmt.Sprintf("Trivia stopped, the answer was %s", answer))
+			return
+		case <-b.stop:
+			return
+		}
+	}
+}
+
+// triviaWinner saves the viewer's score and gives them the reward if points are turned on
+func (b *Bot) triviaWinner(cmd *commands.Command, answer string, s *trivia.Settings) {
+	reward := int64(0)
+	ps := b.pointsSettings()
+	if ps != nil {
+		reward = s.Reward
+	}
+
+	msg := fmt.Sprintf("@%s got it! The answer was %s", cmd.Get("username"), answer)
+	if _, err := trivia.Win(b.bucketKey(), cmd.Get("publicId"), cmd.Get("username"), reward); err != nil {
+		log.Printf("msg='error-saving-trivia-winner', userPublicId='%s', error='%v'\n", b.UserPublicId, err)
+	} else if reward > 0 {
+		msg += fmt.Sprintf(" (+%d %s)", reward, ps.Currency)
+	}
+	b.bot.Say(msg)
+}
+
+// guessTrivia passes a chat message to the running question. It never waits, a guess is dropped if the round is
+// busy.
+func (b *Bot) guessTrivia(cmd *commands.Command) {
+	m := strings.TrimSpace(cmd.Get("message"))
+	if len(m) == 0 || m[0] == '!' || cmd.Get("bot") == "true" {
+		return
+	}
+
+	r := b.trivia.get()
+	if r == nil {
+		return
+	}
+
+	select {
+	case r.guesses <- cmd:
+	default:
+	}
+}
+
+// triviaCommand: !trivia asks a question, !trivia top shows the leaderboard and moderators can end the question
+// with !trivia stop
+func (b *Bot) triviaCommand(cmd *commands.Command, args []string) string {
+	s := b.triviaSettings()
+	if s == nil {
+		return ""
+	}
+
+	if len(args) > 0 {
+		switch args[0] {
+		case "top":
+			return b.triviaTop()
+		case "stop":
+			if !moderation.IsModerator(cmd.Get("role")) {
+				return ""
+			}
+			b.trivia.mx.Lock()
+			r := b.trivia.round
+			if r != nil {
+				b.trivia.round = nil
+				close(r.end)
+			}
+			b.trivia.mx.Unlock()
+			if r == nil {
+				return ErrNoTrivia.Error()
+			}
+			return ""
+		}
+	}
+
+	switch err := b.askTrivia(s); err {
+	case nil:
+		return ""
+	case ErrTriviaRunning:
+		if r := b.trivia.get(); r != nil {
+			return "Trivia: " + r.question.Question
+		}
+		return ""
+	case trivia.ErrNoQuestions:
+		return err.Error()
+	default:
+		log.Printf("msg='error-asking-trivia', userPublicId='%s', error='%v'\n", b.UserPublicId, err)
+		return "Something went wrong, try again"
+	}
+}
+
+// triviaTop lists the viewers with the most correct answers
+func (b *Bot) triviaTop() string {
+	scores, err := trivia.GetScores(b.bucketKey(), TopPoints)
+	if err != nil {
+		return "Something went wrong, try again"
+	}
+	if len(scores) == 0 {
+		return "Nobody has answered a trivia question yet"
+	}
+
+	top := make([]string, len(scores))
+	for i, s := range scores {
+		top[i] = fmt.Sprintf("%d. %s (%d)", i+1, s.Username, s.Correct)
+	}
+	return "Top trivia: " + strings.Join(top, ", ")
+}
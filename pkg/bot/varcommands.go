@@ -0,0 +1,94 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/StreamMeBots/meep/pkg/moderation"
+	"github.com/StreamMeBots/meep/pkg/variables"
+	"github.com/StreamMeBots/pkg/commands"
+)
+
+// counterCommand lets moderators change a counter from chat: !<counter> +1, !<counter> -1 or !<counter> =5. Only
+// counters that already exist can be changed so other commands that take a number aren't taken over, new counters
+// are made from the dashboard or with incr in a template. false is returned if the message doesn't change a counter.
+func (b *Bot) counterCommand(cmd *commands.Command) bool {
+	fields := strings.Fields(cmd.Get("message"))
+	if len(fields) != 2 || len(fields[1]) < 2 || !moderation.IsModerator(cmd.Get("role")) {
+		return false
+	}
+
+	op := fields[1][0]
+	if op != '+' && op != '-' && op != '=' {
+		return false
+	}
+	n, err := strconv.ParseInt(fields[1][1:], 10, 64)
+	if err != nil || n < 0 {
+		return false
+	}
+
+	name := variables.Name(fields[0])
+	if variables.ValidateName(name) != nil {
+		return false
+	}
+	if ok, err := variables.HasCounter(b.bucketKey(), name); err != nil || !ok {
+		return false
+	}
+
+	var v int64
+	switch op {
+	case '+':
+		v, err = variables.Incr(b.bucketKey(), name, n)
+	case '-':
+		v, err = variables.Incr(b.bucketKey(), name, -n)
+	case '=':
+		v, err = n, variables.SetCounter(b.bucketKey(), name, n)
+	}
+	if err != nil {
+		log.Printf("msg='error-changing-counter', userPublicId='%s', counter='%s', error='%v'\n", b.UserPublicId, name, err)
+		b.bot.Say("Something went wrong, try again")
+		return true
+	}
+
+	b.bot.Say(fmt.Sprintf("%s: %d", name, v))
+	return true
+}
+
+// setVarCommand: !setvar <name> <value>
+func (b *Bot) setVarCommand(cmd *commands.Command, args []string) string {
+	if len(args) < 2 {
+		return "Usage: !setvar <name> <value>"
+	}
+
+	v := &variables.Variable{
+		Name:  variables.Name(args[0]),
+		Value: afterFields(cmd.Get("message"), 2),
+	}
+	if err := v.Validate(); err != nil {
+		return err.Error()
+	}
+	if err := v.Save(b.bucketKey()); err != nil {
+		return "Something went wrong, try again"
+	}
+
+	return fmt.Sprintf("%s has been set", v.Name)
+}
+
+// delVarCommand: !delvar <name>
+func (b *Bot) delVarCommand(cmd *commands.Command, args []string) string {
+	if len(args) < 1 {
+		return "Usage: !delvar <name>"
+	}
+
+	name := variables.Name(args[0])
+	err := variables.DeleteVar(b.bucketKey(), name)
+	if err == variables.ErrNotFound {
+		return fmt.Sprintf("%s isn't set", name)
+	} else if err != nil {
+		return "Something went wrong, try again"
+	}
+
+	return fmt.Sprintf("%s has been deleted", name)
+}
@@ -13,13 +13,22 @@ import (
 	"github.com/boltdb/bolt"
 )
 
-var ErrIntNotSet = errors.New("int not set")
+// Errors
+var (
+	ErrIntNotSet      = errors.New("int not set")
+	ErrBucketNotFound = errors.New("bucket not found")
+)
 
 // buckets
 var (
 	userData              = []byte(`user.data`)
 	userGreetingTemplates = []byte(`user.greetings.templates`)
 	runningBots           = []byte(`bots.running`)
+	userSessions          = []byte(`user.sessions`)
+	userModerationLadders = []byte(`user.moderation.ladders`)
+	userSettings          = []byte(`user.settings`)
+	userPointsSettings    = []byte(`user.points.settings`)
+	userTriviaSettings    = []byte(`user.trivia.settings`)
 
 	// partial
 	botGreetings            = []byte(`bot.greetings:`)
@@ -27,9 +36,24 @@ var (
 	botStatsLinesPerDay     = []byte(`bot.stats.lines.perday:`)
 	botStatsCommandsPerHour = []byte(`bot.stats.commands.perhour:`)
 	botStatsCommandsPerDay  = []byte(`bot.stats.commands.perday:`)
-	botStatsLastCommand     = []byte(`bot.stats.commands.last:`)
+	botCooldowns            = []byte(`bot.cooldowns:`)
+	botModerationStrikes    = []byte(`bot.moderation.strikes:`)
+	botModerationTimeouts   = []byte(`bot.moderation.timeouts:`)
+	botViewerTags           = []byte(`bot.viewers.tags:`)
+	botCounters             = []byte(`bot.counters:`)
+	botVariables            = []byte(`bot.variables:`)
+	botQuotes               = []byte(`bot.quotes:`)
+	botPolls                = []byte(`bot.polls:`)
+	botGiveaways            = []byte(`bot.giveaways:`)
+	botPoints               = []byte(`bot.points:`)
+	botPointsLedger         = []byte(`bot.points.ledger:`)
+	botPredictions          = []byte(`bot.predictions:`)
+	botTriviaPacks          = []byte(`bot.trivia.packs:`)
+	botTriviaScores         = []byte(`bot.trivia.scores:`)
+	botTranscripts          = []byte(`bot.transcripts:`)
 
-	userCommands = []byte(`user.commands:`)
+	userCommands          = []byte(`user.commands:`)
+	userModerationFilters = []byte(`user.moderation.filters:`)
 )
 
 // Bucket wraps the bolt bucket - future proofing
@@ -48,6 +72,21 @@ func Init() {
 		if _, err := tx.CreateBucketIfNotExists(runningBots); err != nil {
 			return err
 		}
+		if _, err := tx.CreateBucketIfNotExists(userSessions); err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucketIfNotExists(userModerationLadders); err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucketIfNotExists(userSettings); err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucketIfNotExists(userPointsSettings); err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucketIfNotExists(userTriviaSettings); err != nil {
+			return err
+		}
 		return nil
 	})
 	if err != nil {
@@ -75,8 +114,18 @@ func CommandsPerHour(tx *bolt.Tx, botUserPublicId, command []byte) (Bucket, erro
 	return createBucket(tx, createKey(botStatsCommandsPerHour, botUserPublicId, command))
 }
 
-func LastCommand(tx *bolt.Tx, botUserPublicId []byte) (Bucket, error) {
-	return createBucket(tx, createKey(botStatsLastCommand, botUserPublicId))
+// EachCommandPerDay calls fn with each command's per day stats bucket
+func EachCommandPerDay(tx *bolt.Tx, botUserPublicId []byte, fn func(command []byte, bkt Bucket) error) error {
+	return eachBucket(tx, createKey(botStatsCommandsPerDay, botUserPublicId, nil), fn)
+}
+
+// EachCommandPerHour calls fn with each command's per hour stats bucket
+func EachCommandPerHour(tx *bolt.Tx, botUserPublicId []byte, fn func(command []byte, bkt Bucket) error) error {
+	return eachBucket(tx, createKey(botStatsCommandsPerHour, botUserPublicId, nil), fn)
+}
+
+func Cooldowns(tx *bolt.Tx, botUserPublicId []byte) (Bucket, error) {
+	return createBucket(tx, createKey(botCooldowns, botUserPublicId))
 }
 
 func BotGreetings(tx *bolt.Tx, botUserPublicId []byte) (Bucket, error) {
@@ -87,6 +136,66 @@ func UserCommands(userBucket []byte, tx *bolt.Tx) (Bucket, error) {
 	return createBucket(tx, createKey(userCommands, userBucket))
 }
 
+func ModerationFilters(tx *bolt.Tx, botUserPublicId []byte) (Bucket, error) {
+	return createBucket(tx, createKey(userModerationFilters, botUserPublicId))
+}
+
+func ModerationStrikes(tx *bolt.Tx, botUserPublicId []byte) (Bucket, error) {
+	return createBucket(tx, createKey(botModerationStrikes, botUserPublicId))
+}
+
+func ModerationTimeouts(tx *bolt.Tx, botUserPublicId []byte) (Bucket, error) {
+	return createBucket(tx, createKey(botModerationTimeouts, botUserPublicId))
+}
+
+func ViewerTags(tx *bolt.Tx, botUserPublicId []byte) (Bucket, error) {
+	return createBucket(tx, createKey(botViewerTags, botUserPublicId))
+}
+
+func Counters(tx *bolt.Tx, botUserPublicId []byte) (Bucket, error) {
+	return createBucket(tx, createKey(botCounters, botUserPublicId))
+}
+
+func Variables(tx *bolt.Tx, botUserPublicId []byte) (Bucket, error) {
+	return createBucket(tx, createKey(botVariables, botUserPublicId))
+}
+
+func Quotes(tx *bolt.Tx, botUserPublicId []byte) (Bucket, error) {
+	return createBucket(tx, createKey(botQuotes, botUserPublicId))
+}
+
+func Polls(tx *bolt.Tx, botUserPublicId []byte) (Bucket, error) {
+	return createBucket(tx, createKey(botPolls, botUserPublicId))
+}
+
+func Giveaways(tx *bolt.Tx, botUserPublicId []byte) (Bucket, error) {
+	return createBucket(tx, createKey(botGiveaways, botUserPublicId))
+}
+
+func Points(tx *bolt.Tx, botUserPublicId []byte) (Bucket, error) {
+	return createBucket(tx, createKey(botPoints, botUserPublicId))
+}
+
+func PointsLedger(tx *bolt.Tx, botUserPublicId []byte) (Bucket, error) {
+	return createBucket(tx, createKey(botPointsLedger, botUserPublicId))
+}
+
+func Predictions(tx *bolt.Tx, botUserPublicId []byte) (Bucket, error) {
+	return createBucket(tx, createKey(botPredictions, botUserPublicId))
+}
+
+func TriviaPacks(tx *bolt.Tx, botUserPublicId []byte) (Bucket, error) {
+	return createBucket(tx, createKey(botTriviaPacks, botUserPublicId))
+}
+
+func TriviaScores(tx *bolt.Tx, botUserPublicId []byte) (Bucket, error) {
+	return createBucket(tx, createKey(botTriviaScores, botUserPublicId))
+}
+
+func Transcripts(tx *bolt.Tx, botUserPublicId []byte) (Bucket, error) {
+	return createBucket(tx, createKey(botTranscripts, botUserPublicId))
+}
+
 func UserData(tx *bolt.Tx) Bucket {
 	return Bucket{tx.Bucket(userData)}
 }
@@ -99,13 +208,57 @@ func RunningBots(tx *bolt.Tx) Bucket {
 	return Bucket{tx.Bucket(runningBots)}
 }
 
+func ModerationLadders(tx *bolt.Tx) Bucket {
+	return Bucket{tx.Bucket(userModerationLadders)}
+}
+
+func UserSettings(tx *bolt.Tx) Bucket {
+	return Bucket{tx.Bucket(userSettings)}
+}
+
+func PointsSettings(tx *bolt.Tx) Bucket {
+	return Bucket{tx.Bucket(userPointsSettings)}
+}
+
+func TriviaSettings(tx *bolt.Tx) Bucket {
+	return Bucket{tx.Bucket(userTriviaSettings)}
+}
+
+func UserSessions(tx *bolt.Tx) Bucket {
+	return Bucket{tx.Bucket(userSessions)}
+}
+
 // createKey is a helper function to join multiple slices with ':'
 func createKey(keys ...[]byte) []byte {
 	return bytes.Join(keys, []byte(`:`))
 }
 
-// createBucket is a helper function for creating a Bucket
+// eachBucket calls fn with each top level bucket whose key starts with prefix, name is the rest of the key
+func eachBucket(tx *bolt.Tx, prefix []byte, fn func(name []byte, bkt Bucket) error) error {
+	crs := tx.Cursor()
+	for k, v := crs.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = crs.Next() {
+		// buckets have nil values
+		if v != nil {
+			continue
+		}
+		if err := fn(k[len(prefix):], Bucket{tx.Bucket(k)}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createBucket is a helper function for creating a Bucket. Read only transactions can't create buckets so
+// ErrBucketNotFound is returned if the bucket has not been created yet.
 func createBucket(tx *bolt.Tx, key []byte) (Bucket, error) {
+	if !tx.Writable() {
+		bkt := tx.Bucket(key)
+		if bkt == nil {
+			return Bucket{}, ErrBucketNotFound
+		}
+		return Bucket{bkt}, nil
+	}
+
 	bkt, err := tx.CreateBucketIfNotExists(key)
 	if err != nil {
 		return Bucket{}, err
@@ -127,14 +280,19 @@ func Decr(bkt *bolt.Bucket, key []byte) (int64, error) {
 	return v, nil
 }
 
-// Incr increments
+// Incr increments, a value that is not set yet starts at 0
 func Incr(bkt *bolt.Bucket, key []byte) (int64, error) {
+	return IncrBy(bkt, key, 1)
+}
+
+// IncrBy adds n, a value that is not set yet starts at 0
+func IncrBy(bkt *bolt.Bucket, key []byte, n int64) (int64, error) {
 	c, err := GetInt64(bkt, key)
-	if err != nil {
+	if err != nil && err != ErrIntNotSet {
 		return 0, err
 	}
 
-	v := c + 1
+	v := c + n
 	if err := SetInt64(bkt, key, v); err != nil {
 		return 0, err
 	}
@@ -0,0 +1,183 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// argument types
+const (
+	ArgString = "string"
+	ArgInt    = "int"
+	ArgNumber = "number"
+	ArgUser   = "user"
+)
+
+var argTypes = map[string]bool{
+	"":        true,
+	ArgString: true,
+	ArgInt:    true,
+	ArgNumber: true,
+	ArgUser:   true,
+}
+
+// MaxArgs is the most arguments a command can declare
+var MaxArgs = 10
+
+// Arg declares one of a command's arguments
+type Arg struct {
+	Name     string `json:"name"`
+	Type     string `json:"type,omitempty"` // empty means string
+	Optional bool   `json:"optional,omitempty"`
+}
+
+// Validate validates the Arg
+func (a *Arg) Validate() error {
+	if len(a.Name) == 0 || len(a.Name) > 30 || strings.ContainsAny(a.Name, " \t") {
+		return fmt.Errorf("Argument name should be between 1 and 30 characters without spaces")
+	}
+	if !argTypes[a.Type] {
+		return fmt.Errorf("Argument type should be one of string, int, number or user")
+	}
+	return nil
+}
+
+// check checks if the value has the argument's type
+func (a *Arg) check(v string) bool {
+	switch a.Type {
+	case ArgInt:
+		_, err := strconv.Atoi(v)
+		return err == nil
+	case ArgNumber:
+		_, err := strconv.ParseFloat(v, 64)
+		return err == nil
+	case ArgUser:
+		return len(strings.TrimPrefix(v, "@")) > 0
+	}
+	return true
+}
+
+// Usage returns the command's usage message generated from its declared arguments
+func (c *Command) Usage() string {
+	usage := "Usage: " + c.Name
+	for _, a := range c.Args {
+		name := a.Name
+		if a.Type == ArgInt || a.Type == ArgNumber {
+			name += ":" + a.Type
+		}
+		if a.Optional {
+			usage += " [" + name + "]"
+		} else {
+			usage += " <" + name + ">"
+		}
+	}
+	return usage
+}
+
+// CheckArgs checks the arguments a command was used with against the declared arguments. The error's message is
+// the command's usage.
+func (c *Command) CheckArgs(args []string) error {
+	for i, a := range c.Args {
+		if i >= len(args) {
+			if a.Optional {
+				return nil
+			}
+			return errors.New(c.Usage())
+		}
+		if !a.check(args[i]) {
+			return errors.New(c.Usage())
+		}
+	}
+	return nil
+}
+
+// Data is the data command templates are executed with. The chat command's arguments, e.g. username and message,
+// can be used directly, {{.username}}, and the methods give the words of the message.
+type Data map[string]string
+
+// Args returns the words after the command's name
+func (d Data) Args() []string {
+	words := Tokenize(d["message"])
+	if len(words) == 0 {
+		return words
+	}
+	return words[1:]
+}
+
+// Arg returns the n-th word after the command's name starting at 1, or an empty string if there isn't one
+func (d Data) Arg(n int) string {
+	args := d.Args()
+	if n < 1 || n > len(args) {
+		return ""
+	}
+	return args[n-1]
+}
+
+// Rest returns the message after the command's name as it was typed
+func (d Data) Rest() string {
+	m := strings.TrimSpace(d["message"])
+	i := strings.IndexFunc(m, unicode.IsSpace)
+	if i < 0 {
+		return ""
+	}
+	return strings.TrimSpace(m[i:])
+}
+
+// Sender returns the username of the viewer that used the command
+func (d Data) Sender() string {
+	return d["username"]
+}
+
+// Role returns the chat role of the viewer that used the command
+func (d Data) Role() string {
+	return d["role"]
+}
+
+// Target returns the user the command was used on, the first argument without a leading @. The sender is the
+// target when the command was used without arguments.
+func (d Data) Target() string {
+	if t := strings.TrimPrefix(d.Arg(1), "@"); len(t) > 0 {
+		return t
+	}
+	return d.Sender()
+}
+
+// Tokenize splits a chat message into words. Words starting with a double or single quote continue until the
+// closing quote so they can contain spaces.
+func Tokenize(s string) []string {
+	words := []string{}
+	word := []rune{}
+	inWord := false
+	var quote rune
+
+	for _, r := range s {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				word = append(word, r)
+			}
+		case !inWord && (r == '"' || r == '\''):
+			quote = r
+			inWord = true
+		case unicode.IsSpace(r):
+			if inWord {
+				words = append(words, string(word))
+				word = word[:0]
+				inWord = false
+			}
+		default:
+			word = append(word, r)
+			inWord = true
+		}
+	}
+	if inWord {
+		words = append(words, string(word))
+	}
+
+	return words
+}
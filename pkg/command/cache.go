@@ -0,0 +1,126 @@
+package command
+
+import (
+	"encoding/json"
+	"log"
+	"sort"
+	"sync"
+
+	"github.com/StreamMeBots/meep/pkg/buckets"
+	"github.com/StreamMeBots/meep/pkg/db"
+	"github.com/StreamMeBots/meep/pkg/templates"
+
+	"github.com/boltdb/bolt"
+)
+
+// cache keeps each user's commands in memory so chat doesn't read the db for every command. A user's commands are
+// loaded on first use and dropped by Save and Delete.
+var cache = struct {
+	sync.Mutex
+	users map[string]map[string]*Command
+	gens  map[string]uint64 // changes when a user's commands are invalidated so stale loads aren't kept
+}{
+	users: map[string]map[string]*Command{},
+	gens:  map[string]uint64{},
+}
+
+// cached gets a user's commands from the cache, loading them if needed. The commands shouldn't be changed.
+func cached(userBucket []byte) (map[string]*Command, error) {
+	key := string(userBucket)
+
+	cache.Lock()
+	cmds, ok := cache.users[key]
+	gen := cache.gens[key]
+	cache.Unlock()
+	if ok {
+		return cmds, nil
+	}
+
+	cmds = map[string]*Command{}
+	err := db.DB.View(func(tx *bolt.Tx) error {
+		bkt, err := buckets.UserCommands(userBucket, tx)
+		if err == buckets.ErrBucketNotFound {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		return bkt.ForEach(func(k, v []byte) error {
+			cmd := &Command{}
+			if err := json.Unmarshal(v, &cmd); err != nil {
+				log.Printf("msg='json-unmarshal-error', key='%v' value='%v' error='%v'\n", string(k), string(v), err)
+				return nil
+			}
+
+			cmd.compiledTmpl = &compiledTemplate{text: cmd.Template}
+			cmds[cmd.Name] = cmd
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	cache.Lock()
+	if cache.gens[key] == gen {
+		cache.users[key] = cmds
+	}
+	cache.Unlock()
+
+	return cmds, nil
+}
+
+// sortedCommands copies the commands sorted by name, the order they are stored in
+func sortedCommands(cmds map[string]*Command) []*Command {
+	sorted := make([]*Command, 0, len(cmds))
+	for _, c := range cmds {
+		sorted = append(sorted, c.copy())
+	}
+	sort.Sort(byName(sorted))
+	return sorted
+}
+
+type byName []*Command
+
+func (c byName) Len() int           { return len(c) }
+func (c byName) Swap(i, j int)      { c[i], c[j] = c[j], c[i] }
+func (c byName) Less(i, j int) bool { return c[i].Name < c[j].Name }
+
+// invalidate drops a user's cached commands, it's called after they change
+func invalidate(userBucket []byte) {
+	key := string(userBucket)
+
+	cache.Lock()
+	delete(cache.users, key)
+	cache.gens[key]++
+	cache.Unlock()
+}
+
+// copy copies a cached command so callers can change it. The compiled template is shared.
+func (c *Command) copy() *Command {
+	cp := *c
+	cp.Args = append([]Arg(nil), c.Args...)
+	return &cp
+}
+
+// compiledTemplate is a cached command's template, parsed the first time the command is used
+type compiledTemplate struct {
+	once sync.Once
+	text string
+	tmpl *templates.Template
+	err  error
+}
+
+// compiled gets the command's parsed template. Commands that aren't cached or whose template was changed after
+// they were read are parsed every time.
+func (c *Command) compiled() (*templates.Template, error) {
+	ct := c.compiledTmpl
+	if ct == nil || ct.text != c.Template {
+		return templates.Parse(c.Template)
+	}
+
+	ct.once.Do(func() {
+		ct.tmpl, ct.err = templates.Parse(ct.text)
+	})
+	return ct.tmpl, ct.err
+}
@@ -1,29 +1,100 @@
 package command
 
 import (
-	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
-	"text/template"
+	"strings"
+	"time"
 
 	"github.com/StreamMeBots/meep/pkg/buckets"
 	"github.com/StreamMeBots/meep/pkg/db"
+	"github.com/StreamMeBots/meep/pkg/moderation"
+	"github.com/StreamMeBots/meep/pkg/templates"
+	"github.com/StreamMeBots/meep/pkg/user"
+	"github.com/StreamMeBots/meep/pkg/variables"
+	"github.com/StreamMeBots/meep/pkg/viewers"
 	"github.com/StreamMeBots/pkg/commands"
 
 	"github.com/boltdb/bolt"
 )
 
 // Errors
-var ErrCommandNotFound = errors.New("Command not found")
+var (
+	ErrCommandNotFound = errors.New("Command not found")
+	ErrCommandDepth    = errors.New("Commands use each other too deeply")
+)
+
+// DefaultCooldown is the cooldown in seconds of commands that don't have a throttle or any cooldowns
+var DefaultCooldown = 5
+
+// MaxCooldown is the longest cooldown in seconds a command can have
+var MaxCooldown = 24 * 60 * 60
+
+// permission levels
+const (
+	PermissionEveryone  = "everyone"
+	PermissionRegular   = "regular"   // viewers tagged as regulars
+	PermissionTag       = "tag"       // viewers with the command's Tag
+	PermissionModerator = "moderator" // owner, moderator and admin chat roles
+	PermissionOwner     = "owner"     // owner and admin chat roles
+)
+
+var permissions = map[string]bool{
+	"":                  true,
+	PermissionEveryone:  true,
+	PermissionRegular:   true,
+	PermissionTag:       true,
+	PermissionModerator: true,
+	PermissionOwner:     true,
+}
 
 // Command represents a command response template.
 type Command struct {
-	Name     string `json:"name"`
-	Template string `json:"template"`
-	Timer    int    `json:"timerDuration,omitempty"` // 0 indicates no timer, 1 min intervals
-	Throttle int64  `json:"throttle,omitempty"`      // 0 means no throttle
+	Name         string `json:"name"`
+	Template     string `json:"template"`
+	Timer        int    `json:"timerDuration,omitempty"` // 0 indicates no timer, 1 min intervals
+	Throttle     int64  `json:"throttle,omitempty"`      // chat lines between uses, 0 means no throttle
+	Cooldown     int    `json:"cooldown,omitempty"`      // seconds between uses, 0 means no cooldown
+	UserCooldown int    `json:"userCooldown,omitempty"`  // seconds between uses by the same viewer
+	ModBypass    bool   `json:"modBypass,omitempty"`     // moderators ignore the throttle and cooldowns
+	Permission   string `json:"permission,omitempty"`    // empty means everyone
+	Tag          string `json:"tag,omitempty"`           // viewer tag needed when Permission is tag
+	DenyMessage  string `json:"denyMessage,omitempty"`   // said when a viewer without permission uses the command
+	Args         []Arg  `json:"args,omitempty"`          // declared arguments, the usage is said when they are missing
+
+	compiledTmpl *compiledTemplate // set on cached commands
+}
+
+// Allowed checks if a viewer with the chat role and tags can use the command. tags is only called when the
+// viewer's tags are needed.
+func (c *Command) Allowed(role string, tags func() []string) bool {
+	isOwner := role == "owner" || role == "admin"
+	isMod := moderation.IsModerator(role)
+
+	switch c.Permission {
+	case PermissionOwner:
+		return isOwner
+	case PermissionModerator:
+		return isMod
+	case PermissionRegular, PermissionTag:
+		if isMod {
+			return true
+		}
+		tag := c.Tag
+		if c.Permission == PermissionRegular {
+			tag = viewers.TagRegular
+		}
+		for _, t := range tags() {
+			if strings.EqualFold(t, tag) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return true
 }
 
 // Validate validates the Command
@@ -34,8 +105,38 @@ func (c *Command) Validate() error {
 	if len(c.Template) == 0 || len(c.Template) > 500 {
 		return fmt.Errorf("Command Template should be between 1 and 500 characters")
 	}
+	if c.Timer < 0 {
+		return fmt.Errorf("Command timerDuration cannot be negative")
+	}
+	if c.Throttle < 0 {
+		return fmt.Errorf("Command throttle cannot be negative")
+	}
+	if c.Cooldown < 0 || c.Cooldown > MaxCooldown || c.UserCooldown < 0 || c.UserCooldown > MaxCooldown {
+		return fmt.Errorf("Command cooldown and userCooldown should be between 0 and %d seconds", MaxCooldown)
+	}
+	if !permissions[c.Permission] {
+		return fmt.Errorf("Command permission should be one of everyone, regular, tag, moderator or owner")
+	}
+	if c.Permission == PermissionTag && (len(c.Tag) == 0 || len(c.Tag) > 50) {
+		return fmt.Errorf("Command tag should be between 1 and 50 characters")
+	}
+	if len(c.DenyMessage) > 500 {
+		return fmt.Errorf("Command denyMessage cannot exceed 500 characters")
+	}
+
+	if len(c.Args) > MaxArgs {
+		return fmt.Errorf("Command can have at most %d args", MaxArgs)
+	}
+	for i, a := range c.Args {
+		if err := a.Validate(); err != nil {
+			return err
+		}
+		if i > 0 && c.Args[i-1].Optional && !a.Optional {
+			return fmt.Errorf("Command args that are required must come before the optional args")
+		}
+	}
 
-	if _, err := template.New("foo").Parse(c.Template); err != nil {
+	if _, err := templates.Parse(c.Template); err != nil {
 		return fmt.Errorf("Error parsing Template: %v", err)
 	}
 
@@ -57,6 +158,7 @@ func (c *Command) Save(userBucket []byte) error {
 
 		return bkt.Put([]byte(c.Name), b)
 	})
+	invalidate(userBucket)
 
 	if err != nil {
 		log.Println("msg='error-saving-command', error='%v', userBucket='%s'", err, string(userBucket))
@@ -68,35 +170,18 @@ func (c *Command) Save(userBucket []byte) error {
 
 // Get gets a single command
 func Get(userBucket []byte, name string) (*Command, error) {
-	var cmd *Command
-	err := db.DB.Update(func(tx *bolt.Tx) error {
-		bkt, err := buckets.UserCommands(userBucket, tx)
-		if err != nil {
-			return err
-		}
-
-		b := bkt.Get([]byte(name))
-		if b == nil {
-			return nil
-		}
-
-		if err := json.Unmarshal(b, &cmd); err != nil {
-			return err
-		}
-
-		return nil
-	})
-
+	cmds, err := cached(userBucket)
 	if err != nil {
 		log.Printf("msg='error-reading-command', error='%v', userBucket='%s'\n", err, string(userBucket))
 		return nil, err
 	}
 
-	if cmd == nil {
+	cmd, ok := cmds[name]
+	if !ok {
 		return nil, ErrCommandNotFound
 	}
 
-	return cmd, nil
+	return cmd.copy(), nil
 }
 
 // GetCommandsWithTimers gets all of a user's commands that have a timer
@@ -118,35 +203,13 @@ func GetCommandsWithTimers(userPublicId []byte) ([]*Command, error) {
 
 // GetAll gets all of a user's commands
 func GetAll(userBucket []byte) ([]*Command, error) {
-	cmds := []*Command{}
-
-	err := db.DB.Update(func(tx *bolt.Tx) error {
-		bkt, err := buckets.UserCommands(userBucket, tx)
-		if err != nil {
-			return err
-		}
-
-		bkt.ForEach(func(k, v []byte) error {
-			cmd := &Command{}
-			if err := json.Unmarshal(v, &cmd); err != nil {
-				log.Println("msg='json-unmarshal-error', key='%v' value='%v' error='%v'", string(k), string(v), err)
-				return nil
-			}
-
-			cmds = append(cmds, cmd)
-
-			return nil
-		})
-
-		return nil
-	})
-
+	cmds, err := cached(userBucket)
 	if err != nil {
-		log.Println("msg='error-reading-command', error='%v', userBucket='%s'", err, string(userBucket))
+		log.Printf("msg='error-reading-command', error='%v', userBucket='%s'\n", err, string(userBucket))
 		return nil, err
 	}
 
-	return cmds, nil
+	return sortedCommands(cmds), nil
 }
 
 // Delete deletes a command from a user's bucket
@@ -159,6 +222,7 @@ func Delete(userBucket []byte, name string) error {
 
 		return bkt.Delete([]byte(name))
 	})
+	invalidate(userBucket)
 
 	if err != nil {
 		log.Println("msg='error-saving-command', error='%v', userBucket='%s'", err, string(userBucket))
@@ -168,19 +232,47 @@ func Delete(userBucket []byte, name string) error {
 	return nil
 }
 
+// MaxCommandDepth is how deep commands can use the output of other commands
+var MaxCommandDepth = 3
+
 // Parse parses the command
-func (c *Command) Parse(cmd *commands.Command) string {
-	t, err := template.New("msg").Parse(c.Template)
+func (c *Command) Parse(userBucket []byte, cmd *commands.Command) string {
+	return c.parse(userBucket, Data(cmd.Args), user.Location(userBucket), 0)
+}
+
+func (c *Command) parse(userBucket []byte, data Data, loc *time.Location, depth int) string {
+	t, err := c.compiled()
 	if err != nil {
-		log.Println("msg='error parsing template', template='%s', error='%v'", c.Template, err)
+		log.Printf("msg='error-parsing-template', template='%s', error='%v'\n", c.Template, err)
 		return ""
 	}
 
-	buf := &bytes.Buffer{}
-	if err := t.Execute(buf, cmd.Args); err != nil {
-		log.Println("msg='error executing template', template='%s', data='%+v', error='%v'", c.Template, cmd.Args, err)
+	msg, err := t.Execute(data, templates.Options{
+		Location:  loc,
+		Variables: variables.Store(userBucket),
+		Command: func(name string) (string, error) {
+			if depth >= MaxCommandDepth {
+				return "", ErrCommandDepth
+			}
+			if !strings.HasPrefix(name, "!") {
+				name = "!" + name
+			}
+
+			other, err := Get(userBucket, name)
+			if err != nil {
+				return "", err
+			}
+			// only commands everyone can use can be looked up
+			if other.Permission != "" && other.Permission != PermissionEveryone {
+				return "", ErrCommandNotFound
+			}
+			return other.parse(userBucket, data, loc, depth+1), nil
+		},
+	})
+	if err != nil {
+		log.Printf("msg='error-executing-template', template='%s', data='%+v', error='%v'\n", c.Template, data, err)
 		return ""
 	}
 
-	return buf.String()
+	return msg
 }
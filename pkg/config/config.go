@@ -25,6 +25,8 @@ type Config struct {
 	TokenURL          string `json:"tokenURL"`
 	RedirectURL       string `json:"redirectURL"`
 	Url               string `json:"URL"`
+	SessionKey        string `json:"sessionKey"`
+	PersistCooldowns  bool   `json:"persistCooldowns"`
 	Debug             bool   `json:"debug"`
 }
 
@@ -49,6 +51,8 @@ func init() {
 	flag.StringVar(&Conf.TokenURL, "token-url", "", "oauth2 token url")
 	flag.StringVar(&Conf.RedirectURL, "redirect-url", "http://localhost:8888/redirect-url", "oauth redirect url")
 	flag.StringVar(&Conf.Url, "url", "", "stream.me address")
+	flag.StringVar(&Conf.SessionKey, "session-key", "", "secret used to encrypt the oauth2 tokens saved with a session")
+	flag.BoolVar(&Conf.PersistCooldowns, "persist-cooldowns", false, "save command cooldowns when a bot stops so they survive restarts")
 	flag.BoolVar(&Conf.ServerBehindProxy, "behind-proxy", false, "indicate if the server is behind a proxy")
 	flag.BoolVar(&Conf.Debug, "debug", false, "enable debug logging")
 }
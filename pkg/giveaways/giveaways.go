@@ -0,0 +1,379 @@
+/*
+* Package giveaways runs giveaways and stores each run with its entries and winners so the draws can be audited
+ */
+package giveaways
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/StreamMeBots/meep/pkg/buckets"
+	"github.com/StreamMeBots/meep/pkg/db"
+
+	"github.com/boltdb/bolt"
+)
+
+// Errors
+var (
+	ErrGiveawayNotFound = errors.New("Giveaway not found")
+	ErrClosed           = errors.New("The giveaway is closed")
+	ErrAlreadyEntered   = errors.New("Already entered")
+	ErrNotEligible      = errors.New("Not eligible")
+	ErrNoEntries        = errors.New("There is nobody left to draw")
+)
+
+// giveaway states
+const (
+	StateOpen   = "open"   // viewers can enter
+	StateClosed = "closed" // entries are closed, winners can be drawn
+	StateEnded  = "ended"
+)
+
+// DefaultKeyword is the keyword viewers use to enter when a giveaway doesn't have one
+var DefaultKeyword = "!enter"
+
+// MaxWeight is the most a weighted entry can count for
+var MaxWeight = 10
+
+// Entry is a viewer that entered a giveaway
+type Entry struct {
+	UserPublicId string    `json:"userPublicId"`
+	Username     string    `json:"username"`
+	Weight       int       `json:"weight"`
+	Entered      time.Time `json:"entered"`
+}
+
+// Winner is a drawn entry
+type Winner struct {
+	UserPublicId string    `json:"userPublicId"`
+	Username     string    `json:"username"`
+	Drawn        time.Time `json:"drawn"`
+	Redrawn      bool      `json:"redrawn"` // another winner was drawn in their place
+}
+
+// Giveaway is a giveaway and the rules for entering it
+type Giveaway struct {
+	Id          uint64    `json:"id"`
+	Prize       string    `json:"prize"`
+	Keyword     string    `json:"keyword"`
+	AllowGuests bool      `json:"allowGuests"`
+	MinStreak   int       `json:"minStreak"` // visits in a row, see greetings
+	MinPoints   int64     `json:"minPoints"` // loyalty points balance, see points
+	Weighted    bool      `json:"weighted"`  // entries count once for each visit in a row, up to MaxWeight
+	CreatedBy   string    `json:"createdBy"`
+	State       string    `json:"state"`
+	Started     time.Time `json:"started"`
+	Closed      time.Time `json:"closed,omitempty"`
+	Entries     []*Entry  `json:"entries"`
+	Winners     []*Winner `json:"winners"`
+
+	mx sync.Mutex
+}
+
+// Validate validates the Giveaway
+func (g *Giveaway) Validate() error {
+	if len(g.Prize) > 200 {
+		return fmt.Errorf("Giveaway prize cannot exceed 200 characters")
+	}
+	if len(g.Keyword) > 50 || strings.ContainsAny(g.Keyword, " \t") {
+		return fmt.Errorf("Giveaway keyword should be at most 50 characters without spaces")
+	}
+	if g.MinStreak < 0 {
+		return fmt.Errorf("Giveaway minStreak cannot be negative")
+	}
+	if g.MinPoints < 0 {
+		return fmt.Errorf("Giveaway minPoints cannot be negative")
+	}
+	return nil
+}
+
+// Start opens the giveaway for entries and saves it
+func (g *Giveaway) Start(botBucket []byte) error {
+	g.mx.Lock()
+	if len(g.Keyword) == 0 {
+		g.Keyword = DefaultKeyword
+	}
+	g.State = StateOpen
+	g.Started = time.Now()
+	g.Entries = []*Entry{}
+	g.Winners = []*Winner{}
+	g.mx.Unlock()
+
+	return g.Save(botBucket)
+}
+
+// Enter enters a viewer. streak is the viewer's visits in a row and balance is their points.
+func (g *Giveaway) Enter(userPublicId, username, role string, streak int, balance int64) error {
+	g.mx.Lock()
+	defer g.mx.Unlock()
+
+	if g.State != StateOpen {
+		return ErrClosed
+	}
+	if (role == "guest" && !g.AllowGuests) || streak < g.MinStreak || balance < g.MinPoints {
+		return ErrNotEligible
+	}
+	for _, e := range g.Entries {
+		if e.UserPublicId == userPublicId {
+			return ErrAlreadyEntered
+		}
+	}
+
+	weight := 1
+	if g.Weighted && streak > 1 {
+		weight = streak
+		if weight > MaxWeight {
+			weight = MaxWeight
+		}
+	}
+
+	g.Entries = append(g.Entries, &Entry{
+		UserPublicId: userPublicId,
+		Username:     username,
+		Weight:       weight,
+		Entered:      time.Now(),
+	})
+	return nil
+}
+
+// Close closes the giveaway's entries
+func (g *Giveaway) Close(botBucket []byte) error {
+	g.mx.Lock()
+	if g.State == StateOpen {
+		g.State = StateClosed
+		g.Closed = time.Now()
+	}
+	g.mx.Unlock()
+
+	return g.Save(botBucket)
+}
+
+// Draw closes the giveaway's entries and draws a winner. Entries that already won can't win again and if redraw
+// is true the last winner is marked as redrawn.
+func (g *Giveaway) Draw(botBucket []byte, redraw bool) (*Winner, error) {
+	g.mx.Lock()
+	if g.State == StateOpen {
+		g.State = StateClosed
+		g.Closed = time.Now()
+	}
+
+	won := map[string]bool{}
+	for _, w := range g.Winners {
+		won[w.UserPublicId] = true
+	}
+
+	left := []*Entry{}
+	total := int64(0)
+	for _, e := range g.Entries {
+		if !won[e.UserPublicId] {
+			left = append(left, e)
+			total += int64(e.Weight)
+		}
+	}
+	if total == 0 {
+		g.mx.Unlock()
+		return nil, ErrNoEntries
+	}
+
+	n, err := rand.Int(rand.Reader, big.NewInt(total))
+	if err != nil {
+		g.mx.Unlock()
+		return nil, err
+	}
+
+	pick := n.Int64()
+	var winner *Entry
+	for _, e := range left {
+		if pick < int64(e.Weight) {
+			winner = e
+			break
+		}
+		pick -= int64(e.Weight)
+	}
+
+	if redraw && len(g.Winners) > 0 {
+		g.Winners[len(g.Winners)-1].Redrawn = true
+	}
+	w := &Winner{
+		UserPublicId: winner.UserPublicId,
+		Username:     winner.Username,
+		Drawn:        time.Now(),
+	}
+	g.Winners = append(g.Winners, w)
+	g.mx.Unlock()
+
+	return w, g.Save(botBucket)
+}
+
+// End ends the giveaway
+func (g *Giveaway) End(botBucket []byte) error {
+	g.mx.Lock()
+	if g.Closed.IsZero() {
+		g.Closed = time.Now()
+	}
+	g.State = StateEnded
+	g.mx.Unlock()
+
+	return g.Save(botBucket)
+}
+
+// Snapshot returns a copy of the giveaway that is safe to use while viewers are entering
+func (g *Giveaway) Snapshot() *Giveaway {
+	g.mx.Lock()
+	defer g.mx.Unlock()
+
+	// winners are copied since redrawing changes them
+	winners := make([]*Winner, len(g.Winners))
+	for i, w := range g.Winners {
+		cp := *w
+		winners[i] = &cp
+	}
+
+	return &Giveaway{
+		Id:          g.Id,
+		Prize:       g.Prize,
+		Keyword:     g.Keyword,
+		AllowGuests: g.AllowGuests,
+		MinStreak:   g.MinStreak,
+		MinPoints:   g.MinPoints,
+		Weighted:    g.Weighted,
+		CreatedBy:   g.CreatedBy,
+		State:       g.State,
+		Started:     g.Started,
+		Closed:      g.Closed,
+		Entries:     append([]*Entry{}, g.Entries...),
+		Winners:     winners,
+	}
+}
+
+// Save saves the giveaway, a new giveaway is given the next id
+func (g *Giveaway) Save(botBucket []byte) error {
+	g.mx.Lock()
+	defer g.mx.Unlock()
+
+	err := db.DB.Update(func(tx *bolt.Tx) error {
+		bkt, err := buckets.Giveaways(tx, botBucket)
+		if err != nil {
+			return err
+		}
+
+		if g.Id == 0 {
+			if g.Id, err = bkt.NextSequence(); err != nil {
+				return err
+			}
+		}
+
+		b, err := json.Marshal(g)
+		if err != nil {
+			return err
+		}
+		return bkt.Put(itob(g.Id), b)
+	})
+	if err != nil {
+		log.Printf("msg='error-saving-giveaway', error='%v', botBucket='%s'\n", err, string(botBucket))
+		return err
+	}
+
+	return nil
+}
+
+// Get gets a giveaway
+func Get(botBucket []byte, id uint64) (*Giveaway, error) {
+	var g *Giveaway
+	err := db.DB.View(func(tx *bolt.Tx) error {
+		bkt, err := buckets.Giveaways(tx, botBucket)
+		if err == buckets.ErrBucketNotFound {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		b := bkt.Get(itob(id))
+		if b == nil {
+			return nil
+		}
+		return json.Unmarshal(b, &g)
+	})
+	if err != nil {
+		log.Printf("msg='error-getting-giveaway', error='%v', botBucket='%s', id='%d'\n", err, string(botBucket), id)
+		return nil, err
+	}
+
+	if g == nil {
+		return nil, ErrGiveawayNotFound
+	}
+	return g, nil
+}
+
+// Active gets the giveaway that hasn't ended, it's the last one
+func Active(botBucket []byte) (*Giveaway, error) {
+	var g *Giveaway
+	err := db.DB.View(func(tx *bolt.Tx) error {
+		bkt, err := buckets.Giveaways(tx, botBucket)
+		if err == buckets.ErrBucketNotFound {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		_, v := bkt.Cursor().Last()
+		if v == nil {
+			return nil
+		}
+		return json.Unmarshal(v, &g)
+	})
+	if err != nil {
+		log.Printf("msg='error-getting-active-giveaway', error='%v', botBucket='%s'\n", err, string(botBucket))
+		return nil, err
+	}
+
+	if g == nil || g.State == StateEnded {
+		return nil, ErrGiveawayNotFound
+	}
+	return g, nil
+}
+
+// GetAll gets a bot's giveaways without their entries, newest first
+func GetAll(botBucket []byte) ([]*Giveaway, error) {
+	gs := []*Giveaway{}
+	err := db.DB.View(func(tx *bolt.Tx) error {
+		bkt, err := buckets.Giveaways(tx, botBucket)
+		if err == buckets.ErrBucketNotFound {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		crs := bkt.Cursor()
+		for k, v := crs.Last(); k != nil; k, v = crs.Prev() {
+			g := &Giveaway{}
+			if err := json.Unmarshal(v, &g); err != nil {
+				log.Printf("msg='json-unmarshal-error', error='%v'\n", err)
+				continue
+			}
+			g.Entries = nil
+			gs = append(gs, g)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("msg='error-getting-giveaways', error='%v', botBucket='%s'\n", err, string(botBucket))
+		return nil, err
+	}
+
+	return gs, nil
+}
+
+func itob(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
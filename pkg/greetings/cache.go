@@ -0,0 +1,93 @@
+package greetings
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/StreamMeBots/meep/pkg/buckets"
+	"github.com/StreamMeBots/meep/pkg/db"
+	"github.com/StreamMeBots/meep/pkg/templates"
+
+	"github.com/boltdb/bolt"
+)
+
+// cache keeps each user's greeting templates in memory so joins don't read them from the db. A user's templates are
+// loaded on first use and dropped by Template.Save.
+var cache = struct {
+	sync.Mutex
+	users map[string]*Template // nil when the user has no templates
+	gens  map[string]uint64    // changes when a user's templates are invalidated so stale loads aren't kept
+}{
+	users: map[string]*Template{},
+	gens:  map[string]uint64{},
+}
+
+// cached gets a user's templates from the cache, loading them if needed. nil is returned if the user doesn't have
+// any. The templates shouldn't be changed.
+func cached(userBucket []byte) (*Template, error) {
+	key := string(userBucket)
+
+	cache.Lock()
+	tmpl, ok := cache.users[key]
+	gen := cache.gens[key]
+	cache.Unlock()
+	if ok {
+		return tmpl, nil
+	}
+
+	err := db.DB.View(func(tx *bolt.Tx) error {
+		b := buckets.UserGreetingTemplates(tx).Get(userBucket)
+		if b == nil {
+			return nil
+		}
+		tmpl = &Template{parsed: &parsedTemplates{tmpls: map[string]*templates.Template{}}}
+		return json.Unmarshal(b, tmpl)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	cache.Lock()
+	if cache.gens[key] == gen {
+		cache.users[key] = tmpl
+	}
+	cache.Unlock()
+
+	return tmpl, nil
+}
+
+// invalidate drops a user's cached templates, it's called after they change
+func invalidate(userBucket []byte) {
+	key := string(userBucket)
+
+	cache.Lock()
+	delete(cache.users, key)
+	cache.gens[key]++
+	cache.Unlock()
+}
+
+// parsedTemplates are a cached Template's greetings, parsed the first time they're used
+type parsedTemplates struct {
+	sync.Mutex
+	tmpls map[string]*templates.Template // by the template's text
+}
+
+// compiled gets the parsed template of one of the greetings. Templates that aren't cached are parsed every time.
+func (t *Template) compiled(text string) (*templates.Template, error) {
+	if t.parsed == nil {
+		return templates.Parse(text)
+	}
+
+	t.parsed.Lock()
+	defer t.parsed.Unlock()
+
+	if tmpl, ok := t.parsed.tmpls[text]; ok {
+		return tmpl, nil
+	}
+	tmpl, err := templates.Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	t.parsed.tmpls[text] = tmpl
+	return tmpl, nil
+}
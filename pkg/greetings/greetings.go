@@ -1,21 +1,27 @@
 package greetings
 
 import (
-	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
-	"text/template"
+	"strings"
 	"time"
 
 	"github.com/StreamMeBots/meep/pkg/buckets"
 	"github.com/StreamMeBots/meep/pkg/db"
+	"github.com/StreamMeBots/meep/pkg/templates"
+	"github.com/StreamMeBots/meep/pkg/user"
+	"github.com/StreamMeBots/meep/pkg/variables"
 	"github.com/StreamMeBots/pkg/commands"
 
 	"github.com/boltdb/bolt"
 	"github.com/jinzhu/now"
 )
 
+// Errors
+var ErrViewerNotFound = errors.New("Viewer not found")
+
 // greeting types
 var (
 	newUser          = "newUser"
@@ -37,12 +43,19 @@ type Event struct {
 
 	troll bool
 	tmpl  *Template
+	loc   *time.Location      // the streamer's timezone used by the templates
+	vars  *variables.Snapshot // the bot's counters and variables used by the templates
 }
 
 func (e *Event) BucketKey() []byte {
 	return []byte(e.PublicID)
 }
 
+// Consecutive reports if the viewer came back the day after their last visit
+func (e *Event) Consecutive() bool {
+	return e.Type == consecutiveUser
+}
+
 // Max length of greeting
 var MaxGreetingLen = 500
 
@@ -58,31 +71,33 @@ type Template struct {
 	GreetTrolls        bool   `json:"greetTrolls"`
 	AnsweringMachine   string `json:"answeringMachine"`
 	AnsweringMachineOn bool   `json:"answeringMachineOn"`
+
+	parsed *parsedTemplates // set on cached templates
 }
 
 // Validate validates the Template
 func (t *Template) Validate() error {
 	if len(t.NewUser) > 500 {
 		return fmt.Errorf("newUser greeting cannot exceed 500 characters")
-	} else if _, err := template.New("msg").Parse(t.NewUser); err != nil {
+	} else if _, err := templates.Parse(t.NewUser); err != nil {
 		return fmt.Errorf("newUser is not a valid template: error %v", err)
 	}
 
 	if len(t.ReturningUser) > 500 {
 		return fmt.Errorf("returningUser greeting cannot exceed 500 characters")
-	} else if _, err := template.New("msg").Parse(t.ReturningUser); err != nil {
+	} else if _, err := templates.Parse(t.ReturningUser); err != nil {
 		return fmt.Errorf("returningUser is not a valid template: error %v", err)
 	}
 
 	if len(t.ConsecutiveUser) > 500 {
 		return fmt.Errorf("consecutiveUser greeting cannot exceed 500 characters")
-	} else if _, err := template.New("msg").Parse(t.ConsecutiveUser); err != nil {
+	} else if _, err := templates.Parse(t.ConsecutiveUser); err != nil {
 		return fmt.Errorf("consecutiveUser is not a valid template: error %v", err)
 	}
 
 	if len(t.AnsweringMachine) > 500 {
 		return fmt.Errorf("answeringMachine greeting cannot exceed 500 characters")
-	} else if _, err := template.New("msg").Parse(t.AnsweringMachine); err != nil {
+	} else if _, err := templates.Parse(t.AnsweringMachine); err != nil {
 		return fmt.Errorf("answeringMachine is not a valid template: error %v", err)
 	}
 
@@ -91,7 +106,7 @@ func (t *Template) Validate() error {
 
 // Save saves a Template to a bucket
 func (t *Template) Save(userBucket []byte) error {
-	return db.DB.Update(func(tx *bolt.Tx) error {
+	err := db.DB.Update(func(tx *bolt.Tx) error {
 		b, err := json.Marshal(t)
 		if err != nil {
 			return err
@@ -99,25 +114,93 @@ func (t *Template) Save(userBucket []byte) error {
 
 		return buckets.UserGreetingTemplates(tx).Put(userBucket, b)
 	})
+	invalidate(userBucket)
+	return err
 }
 
 // Get gets a Template from a bucket
 func Get(userBucket []byte) (*Template, error) {
-	tmpl := &Template{}
-	err := db.DB.Update(func(tx *bolt.Tx) error {
-		b := buckets.UserGreetingTemplates(tx).Get(userBucket)
+	tmpl, err := cached(userBucket)
+	if err != nil {
+		log.Printf("msg='error-getting-user-templates', error='%v', userBucket='%s'", err, string(userBucket))
+		return nil, err
+	}
+	if tmpl == nil {
+		return &Template{}, nil
+	}
+
+	// copied so the caller can change it
+	cp := *tmpl
+	return &cp, nil
+}
+
+// FindViewer looks up a viewer that has been greeted by the bot by their username. A leading '@' is ignored.
+func FindViewer(botBucket []byte, username string) (*Event, error) {
+	username = strings.ToLower(strings.TrimPrefix(username, "@"))
+
+	var e *Event
+	err := db.DB.View(func(tx *bolt.Tx) error {
+		grtBkt, err := buckets.BotGreetings(tx, botBucket)
+		if err == buckets.ErrBucketNotFound {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		crs := grtBkt.Cursor()
+		for k, v := crs.First(); k != nil; k, v = crs.Next() {
+			ev := &Event{}
+			if err := json.Unmarshal(v, &ev); err != nil {
+				continue
+			}
+			if strings.ToLower(ev.Username) == username {
+				e = ev
+				return nil
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		log.Printf("msg='error-finding-viewer', error='%v', botBucket='%s'\n", err, string(botBucket))
+		return nil, err
+	}
+
+	if e == nil {
+		return nil, ErrViewerNotFound
+	}
+
+	return e, nil
+}
+
+// GetViewer gets a viewer that has been greeted by the bot by their public id
+func GetViewer(botBucket []byte, userPublicId string) (*Event, error) {
+	var e *Event
+	err := db.DB.View(func(tx *bolt.Tx) error {
+		grtBkt, err := buckets.BotGreetings(tx, botBucket)
+		if err == buckets.ErrBucketNotFound {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		b := grtBkt.Get([]byte(userPublicId))
 		if b == nil {
 			return nil
 		}
-		return json.Unmarshal(b, &tmpl)
+		return json.Unmarshal(b, &e)
 	})
 
 	if err != nil {
-		log.Printf("msg='error-getting-user-templates', error='%v', userBucket='%s'", err, string(userBucket))
+		log.Printf("msg='error-getting-viewer', error='%v', botBucket='%s'\n", err, string(botBucket))
 		return nil, err
 	}
 
-	return tmpl, nil
+	if e == nil {
+		return nil, ErrViewerNotFound
+	}
+
+	return e, nil
 }
 
 func NewEvent(cmd *commands.Command) (Event, error) {
@@ -144,23 +227,26 @@ func Join(botBucket []byte, cmd *commands.Command) Event {
 		return e
 	}
 
-	err = db.DB.Update(func(tx *bolt.Tx) error {
-		// get greeting templates
-		b := buckets.UserGreetingTemplates(tx).Get(botBucket)
-		if b == nil {
-			// no message if we don't have any templates
-			return nil
-		}
-		if err := json.Unmarshal(b, &e.tmpl); err != nil {
-			return err
-		}
+	// get greeting templates
+	if e.tmpl, err = cached(botBucket); err != nil {
+		log.Printf("msg='greetings-join-error', error='%s'\n", err)
+		return e
+	} else if e.tmpl == nil {
+		// no message if we don't have any templates, the visit is still saved so streaks keep counting
+		e.tmpl = &Template{}
+	}
+
+	// read before the update transaction, bolt transactions shouldn't be nested
+	e.loc = user.Location(botBucket)
+	e.vars = variables.NewSnapshot(botBucket)
 
+	err = db.DB.Update(func(tx *bolt.Tx) error {
 		// get chat user's info
 		grtBkt, err := buckets.BotGreetings(tx, botBucket)
 		if err != nil {
 			return err
 		}
-		b = grtBkt.Get(e.BucketKey())
+		b := grtBkt.Get(e.BucketKey())
 		if b != nil {
 			if err := json.Unmarshal(b, &e); err != nil {
 				return err
@@ -171,9 +257,9 @@ func Join(botBucket []byte, cmd *commands.Command) Event {
 		e.Response = ""
 		e.Type = ""
 
-		// populate response and type
+		// populate response and type, visits without a type aren't saved
 		e.populate()
-		if len(e.Response) == 0 {
+		if len(e.Type) == 0 {
 			return nil
 		}
 
@@ -202,7 +288,8 @@ func (e *Event) populate() {
 			e.Private = false
 			return
 		}
-		if len(e.Response) > 0 {
+		// the visit counts even if its template is empty so a streak can't be claimed again by rejoining
+		if len(e.Type) > 0 {
 			e.LastVisit = e.Time
 			e.Time = time.Now()
 			e.Private = e.tmpl.Private
@@ -245,17 +332,21 @@ func (e *Event) populate() {
 }
 
 func (e *Event) parseTemplate(tmpl string) {
-	t, err := template.New("msg").Parse(tmpl)
+	if len(tmpl) == 0 {
+		return
+	}
+
+	t, err := e.tmpl.compiled(tmpl)
 	if err != nil {
-		log.Println("msg='error parsing template', template='%s', error='%v'", tmpl, err)
+		log.Printf("msg='error-parsing-template', template='%s', error='%v'\n", tmpl, err)
 		return
 	}
 
-	buf := &bytes.Buffer{}
-	if err := t.Execute(buf, e); err != nil {
-		log.Println("msg='error executing template', template='%s', data='%+v', error='%v'", tmpl, e, err)
+	msg, err := t.Execute(e, templates.Options{Location: e.loc, Variables: e.vars})
+	if err != nil {
+		log.Printf("msg='error-executing-template', template='%s', data='%+v', error='%v'\n", tmpl, e, err)
 		return
 	}
 
-	e.Response = buf.String()
+	e.Response = msg
 }
@@ -0,0 +1,242 @@
+/*
+* Package moderation checks chat messages against a bot's moderation filters
+ */
+package moderation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/StreamMeBots/meep/pkg/buckets"
+	"github.com/StreamMeBots/meep/pkg/db"
+
+	"github.com/boltdb/bolt"
+)
+
+// Errors
+var ErrFilterNotFound = errors.New("Filter not found")
+
+// filter types
+const (
+	TypeWords   = "words"   // banned words
+	TypeRegex   = "regex"   // banned regular expressions
+	TypeLinks   = "links"   // links to domains that are not allowed
+	TypeCaps    = "caps"    // excessive capital letters
+	TypeSymbols = "symbols" // excessive symbols
+	TypeEmotes  = "emotes"  // too many emotes
+	TypeRepeat  = "repeat"  // the same message sent over and over
+	TypeLength  = "length"  // messages that are too long
+)
+
+// actions taken when a filter matches
+const (
+	ActionErase  = "erase"
+	ActionMute   = "mute"
+	ActionKick   = "kick"
+	ActionBan    = "ban"
+	ActionStrike = "strike" // erase the message and add a strike, the ladder decides what happens next
+)
+
+var filterTypes = map[string]bool{
+	TypeWords:   true,
+	TypeRegex:   true,
+	TypeLinks:   true,
+	TypeCaps:    true,
+	TypeSymbols: true,
+	TypeEmotes:  true,
+	TypeRepeat:  true,
+	TypeLength:  true,
+}
+
+var actions = map[string]bool{
+	ActionErase:  true,
+	ActionMute:   true,
+	ActionKick:   true,
+	ActionBan:    true,
+	ActionStrike: true,
+}
+
+// Filter represents a moderation rule and the action to take when a chat message breaks it.
+type Filter struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Action  string `json:"action"`
+	Enabled bool   `json:"enabled"`
+	Message string `json:"message,omitempty"` // said in chat when the filter matches
+
+	Words          []string `json:"words,omitempty"`          // words
+	Patterns       []string `json:"patterns,omitempty"`       // regex
+	AllowedDomains []string `json:"allowedDomains,omitempty"` // links
+	Percent        int      `json:"percent,omitempty"`        // caps, symbols: percent of the message that is not allowed
+	MinLength      int      `json:"minLength,omitempty"`      // caps, symbols: messages shorter than this are ignored
+	Max            int      `json:"max,omitempty"`            // emotes: max emotes, length: max characters, repeat: max repeats
+	Window         int      `json:"window,omitempty"`         // repeat: seconds a message is remembered
+}
+
+// Validate validates the Filter
+func (f *Filter) Validate() error {
+	if len(f.Name) == 0 || len(f.Name) > 100 {
+		return fmt.Errorf("Filter name should be between 1 and 100 characters")
+	}
+	if !filterTypes[f.Type] {
+		return fmt.Errorf("Filter type '%s' is not supported", f.Type)
+	}
+	if !actions[f.Action] {
+		return fmt.Errorf("Filter action should be one of erase, mute, kick, ban or strike")
+	}
+	if len(f.Message) > 500 {
+		return fmt.Errorf("Filter message cannot exceed 500 characters")
+	}
+
+	switch f.Type {
+	case TypeWords:
+		if len(f.Words) == 0 {
+			return fmt.Errorf("A words filter needs at least one word")
+		}
+		for _, w := range f.Words {
+			// a blank word matches every message
+			if len(strings.TrimSpace(w)) == 0 {
+				return fmt.Errorf("A words filter cannot have blank words")
+			}
+		}
+	case TypeRegex:
+		if len(f.Patterns) == 0 {
+			return fmt.Errorf("A regex filter needs at least one pattern")
+		}
+		for _, p := range f.Patterns {
+			if _, err := regexp.Compile(p); err != nil {
+				return fmt.Errorf("Error parsing pattern '%s': %v", p, err)
+			}
+		}
+	case TypeCaps, TypeSymbols:
+		if f.Percent < 1 || f.Percent > 100 {
+			return fmt.Errorf("A %s filter needs a percent between 1 and 100", f.Type)
+		}
+		if f.MinLength < 0 {
+			return fmt.Errorf("minLength cannot be negative")
+		}
+	case TypeEmotes, TypeLength:
+		if f.Max < 1 {
+			return fmt.Errorf("A %s filter needs a max of at least 1", f.Type)
+		}
+	case TypeRepeat:
+		if f.Max < 1 {
+			return fmt.Errorf("A repeat filter needs a max of at least 1")
+		}
+		if f.Window < 1 {
+			return fmt.Errorf("A repeat filter needs a window of at least 1 second")
+		}
+	}
+
+	return nil
+}
+
+// Save saves the filter
+func (f *Filter) Save(userBucket []byte) error {
+	err := db.DB.Update(func(tx *bolt.Tx) error {
+		b, err := json.Marshal(f)
+		if err != nil {
+			return err
+		}
+
+		bkt, err := buckets.ModerationFilters(tx, userBucket)
+		if err != nil {
+			return err
+		}
+
+		return bkt.Put([]byte(f.Name), b)
+	})
+
+	if err != nil {
+		log.Printf("msg='error-saving-filter', error='%v', userBucket='%s'\n", err, string(userBucket))
+		return err
+	}
+
+	return nil
+}
+
+// Get gets a single filter
+func Get(userBucket []byte, name string) (*Filter, error) {
+	var f *Filter
+	err := db.DB.View(func(tx *bolt.Tx) error {
+		bkt, err := buckets.ModerationFilters(tx, userBucket)
+		if err == buckets.ErrBucketNotFound {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		b := bkt.Get([]byte(name))
+		if b == nil {
+			return nil
+		}
+
+		return json.Unmarshal(b, &f)
+	})
+
+	if err != nil {
+		log.Printf("msg='error-reading-filter', error='%v', userBucket='%s'\n", err, string(userBucket))
+		return nil, err
+	}
+
+	if f == nil {
+		return nil, ErrFilterNotFound
+	}
+
+	return f, nil
+}
+
+// GetAll gets all of a user's filters
+func GetAll(userBucket []byte) ([]*Filter, error) {
+	filters := []*Filter{}
+
+	err := db.DB.View(func(tx *bolt.Tx) error {
+		bkt, err := buckets.ModerationFilters(tx, userBucket)
+		if err == buckets.ErrBucketNotFound {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		return bkt.ForEach(func(k, v []byte) error {
+			f := &Filter{}
+			if err := json.Unmarshal(v, &f); err != nil {
+				log.Printf("msg='json-unmarshal-error', key='%s', error='%v'\n", string(k), err)
+				return nil
+			}
+
+			filters = append(filters, f)
+			return nil
+		})
+	})
+
+	if err != nil {
+		log.Printf("msg='error-reading-filters', error='%v', userBucket='%s'\n", err, string(userBucket))
+		return nil, err
+	}
+
+	return filters, nil
+}
+
+// Delete deletes a filter from a user's bucket
+func Delete(userBucket []byte, name string) error {
+	err := db.DB.Update(func(tx *bolt.Tx) error {
+		bkt, err := buckets.ModerationFilters(tx, userBucket)
+		if err != nil {
+			return err
+		}
+
+		return bkt.Delete([]byte(name))
+	})
+
+	if err != nil {
+		log.Printf("msg='error-deleting-filter', error='%v', userBucket='%s'\n", err, string(userBucket))
+		return err
+	}
+
+	return nil
+}
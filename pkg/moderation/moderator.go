@@ -0,0 +1,342 @@
+package moderation
+
+import (
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/StreamMeBots/pkg/commands"
+)
+
+// ModeratorRoles are the chat roles that can use moderator commands. They are never moderated.
+var ModeratorRoles = map[string]bool{
+	"owner":     true,
+	"moderator": true,
+	"admin":     true,
+}
+
+// IsModerator checks if the chat role is a moderator role
+func IsModerator(role string) bool {
+	return ModeratorRoles[role]
+}
+
+// default thresholds
+var (
+	DefaultMinLength = 10
+)
+
+var (
+	linkRe  = regexp.MustCompile(`(?i)\b(?:https?://)?((?:[a-z0-9-]+\.)+[a-z]{2,})(?:[/:?#]\S*)?`)
+	emoteRe = regexp.MustCompile(`:[a-zA-Z0-9_]+:`)
+)
+
+// ChatModerator is the set of chat actions used to enforce filters. It is implemented by the bot.
+type ChatModerator interface {
+	Say(msg string) error
+	Erase(messageId string) error
+	Mute(userPublicId string) error
+	MuteGuest(userPublicId string) error
+	UnMute(userPublicId string) error
+	ChangeRole(userPublicId string, role string) error
+	Kick(userPublicId string) error
+	Ban(userPublicId string) error
+}
+
+// Violation is returned when a chat message breaks a filter
+type Violation struct {
+	Filter       *Filter
+	UserPublicId string
+	Username     string
+	Role         string
+	MessageId    string
+
+	userBucket []byte
+}
+
+// Apply takes the violated filter's action
+func (v *Violation) Apply(cm ChatModerator) error {
+	var err error
+	switch v.Filter.Action {
+	case ActionErase:
+		err = cm.Erase(v.MessageId)
+	case ActionStrike:
+		if err := cm.Erase(v.MessageId); err != nil {
+			return err
+		}
+		// the ladder decides what happens next
+		_, err = AddStrike(v.userBucket, cm, Offense{
+			UserPublicId: v.UserPublicId,
+			Username:     v.Username,
+			Role:         v.Role,
+			MessageId:    v.MessageId,
+			Reason:       v.Filter.Name,
+			Source:       "filter:" + v.Filter.Name,
+		})
+	case ActionMute:
+		if v.Role == "guest" {
+			err = cm.MuteGuest(v.UserPublicId)
+		} else {
+			err = cm.Mute(v.UserPublicId)
+		}
+	case ActionKick:
+		err = cm.Kick(v.UserPublicId)
+	case ActionBan:
+		err = cm.Ban(v.UserPublicId)
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(v.Filter.Message) > 0 {
+		return cm.Say(v.Filter.Message)
+	}
+	return nil
+}
+
+// compiled is a filter with its matchers ready to use
+type compiled struct {
+	*Filter
+	re      []*regexp.Regexp
+	domains map[string]bool
+}
+
+// sent is a message a viewer sent, used by the repeat filter
+type sent struct {
+	message string
+	time    time.Time
+}
+
+// Moderator checks a bot's chat messages against the bot's filters
+type Moderator struct {
+	userBucket []byte
+
+	mx      sync.Mutex
+	loaded  bool
+	filters []*compiled
+	history map[string][]sent // viewer's recent messages
+	checks  int
+}
+
+// NewModerator is the constructor for Moderator
+func NewModerator(userBucket []byte) *Moderator {
+	return &Moderator{
+		userBucket: userBucket,
+		history:    map[string][]sent{},
+	}
+}
+
+// Reload makes the moderator re-read the filters on the next check
+func (m *Moderator) Reload() {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	m.loaded = false
+}
+
+// load reads and compiles the enabled filters. m.mx must be held.
+func (m *Moderator) load() {
+	if m.loaded {
+		return
+	}
+
+	filters, err := GetAll(m.userBucket)
+	if err != nil {
+		return
+	}
+
+	m.filters = []*compiled{}
+	for _, f := range filters {
+		if !f.Enabled {
+			continue
+		}
+
+		c := &compiled{Filter: f}
+		switch f.Type {
+		case TypeWords:
+			words := make([]string, 0, len(f.Words))
+			for _, w := range f.Words {
+				// blank words would match every message
+				if w = strings.TrimSpace(w); len(w) > 0 {
+					words = append(words, regexp.QuoteMeta(w))
+				}
+			}
+			if len(words) > 0 {
+				c.re = append(c.re, regexp.MustCompile(`(?i)\b(?:`+strings.Join(words, "|")+`)\b`))
+			}
+		case TypeRegex:
+			for _, p := range f.Patterns {
+				re, err := regexp.Compile(p)
+				if err != nil {
+					log.Printf("msg='error-compiling-filter-pattern', filter='%s', error='%v'\n", f.Name, err)
+					continue
+				}
+				c.re = append(c.re, re)
+			}
+		case TypeLinks:
+			c.domains = map[string]bool{}
+			for _, d := range f.AllowedDomains {
+				c.domains[strings.ToLower(d)] = true
+			}
+		}
+		m.filters = append(m.filters, c)
+	}
+	m.loaded = true
+}
+
+// Check checks a SAY command against the filters. nil is returned if the message is allowed.
+func (m *Moderator) Check(cmd *commands.Command) *Violation {
+	if cmd.Get("bot") == "true" || IsModerator(cmd.Get("role")) {
+		return nil
+	}
+
+	msg := cmd.Get("message")
+	publicId := cmd.Get("publicId")
+
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	m.load()
+	repeats := m.remember(publicId, msg)
+
+	for _, f := range m.filters {
+		if !f.matches(msg, repeats) {
+			continue
+		}
+
+		return &Violation{
+			Filter:       f.Filter,
+			UserPublicId: publicId,
+			Username:     cmd.Get("username"),
+			Role:         cmd.Get("role"),
+			MessageId:    cmd.Get("messageId"),
+			userBucket:   m.userBucket,
+		}
+	}
+
+	return nil
+}
+
+// remember records the message and returns how many times the viewer sent it within the longest repeat window.
+// m.mx must be held.
+func (m *Moderator) remember(publicId, msg string) map[time.Duration]int {
+	window := time.Duration(0)
+	for _, f := range m.filters {
+		if f.Type == TypeRepeat && time.Duration(f.Window)*time.Second > window {
+			window = time.Duration(f.Window) * time.Second
+		}
+	}
+	if window == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	msg = strings.ToLower(strings.TrimSpace(msg))
+
+	// forget old messages
+	m.checks++
+	if m.checks%1000 == 0 {
+		for id, h := range m.history {
+			if len(h) == 0 || now.Sub(h[len(h)-1].time) > window {
+				delete(m.history, id)
+			}
+		}
+	}
+
+	h := []sent{}
+	for _, s := range m.history[publicId] {
+		if now.Sub(s.time) <= window {
+			h = append(h, s)
+		}
+	}
+	h = append(h, sent{message: msg, time: now})
+	m.history[publicId] = h
+
+	// count repeats for each window
+	repeats := map[time.Duration]int{}
+	for _, f := range m.filters {
+		if f.Type != TypeRepeat {
+			continue
+		}
+		w := time.Duration(f.Window) * time.Second
+		for _, s := range h {
+			if s.message == msg && now.Sub(s.time) <= w {
+				repeats[w]++
+			}
+		}
+	}
+
+	return repeats
+}
+
+// matches checks if the message breaks the filter
+func (c *compiled) matches(msg string, repeats map[time.Duration]int) bool {
+	switch c.Type {
+	case TypeWords, TypeRegex:
+		for _, re := range c.re {
+			if re.MatchString(msg) {
+				return true
+			}
+		}
+	case TypeLinks:
+		for _, m := range linkRe.FindAllStringSubmatch(msg, -1) {
+			if !c.allowedDomain(strings.ToLower(m[1])) {
+				return true
+			}
+		}
+	case TypeCaps:
+		letters, upper := 0, 0
+		for _, r := range msg {
+			if unicode.IsLetter(r) {
+				letters++
+				if unicode.IsUpper(r) {
+					upper++
+				}
+			}
+		}
+		return letters >= c.minLength() && upper*100 >= letters*c.Percent
+	case TypeSymbols:
+		chars, symbols := 0, 0
+		for _, r := range msg {
+			if unicode.IsSpace(r) {
+				continue
+			}
+			chars++
+			if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+				symbols++
+			}
+		}
+		return chars >= c.minLength() && symbols*100 >= chars*c.Percent
+	case TypeEmotes:
+		return len(emoteRe.FindAllString(msg, -1)) > c.Max
+	case TypeLength:
+		return utf8.RuneCountInString(msg) > c.Max
+	case TypeRepeat:
+		return repeats[time.Duration(c.Window)*time.Second] > c.Max
+	}
+
+	return false
+}
+
+// allowedDomain checks if the domain, or a domain it belongs to, is allowed
+func (c *compiled) allowedDomain(domain string) bool {
+	for {
+		if c.domains[domain] {
+			return true
+		}
+		i := strings.Index(domain, ".")
+		if i < 0 {
+			return false
+		}
+		domain = domain[i+1:]
+	}
+}
+
+func (c *compiled) minLength() int {
+	if c.MinLength > 0 {
+		return c.MinLength
+	}
+	return DefaultMinLength
+}
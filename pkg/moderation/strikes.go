@@ -0,0 +1,325 @@
+package moderation
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"text/template"
+	"time"
+
+	"github.com/StreamMeBots/meep/pkg/buckets"
+	"github.com/StreamMeBots/meep/pkg/db"
+
+	"github.com/boltdb/bolt"
+)
+
+// ladder actions, in addition to the filter actions
+const (
+	ActionWarn = "warn" // say the step's message in chat
+)
+
+var ladderActions = map[string]bool{
+	ActionWarn:  true,
+	ActionErase: true,
+	ActionMute:  true,
+	ActionKick:  true,
+	ActionBan:   true,
+}
+
+// Step is a rung of the escalation ladder
+type Step struct {
+	Strikes int    `json:"strikes"` // number of active strikes needed for the step
+	Action  string `json:"action"`
+	Message string `json:"message,omitempty"` // template said in chat, has .Username, .Strikes and .Reason
+}
+
+// Ladder maps a viewer's number of strikes to an action
+type Ladder struct {
+	Steps []Step `json:"steps"`
+	Decay int    `json:"decay"` // seconds until a strike no longer counts, 0 means strikes never decay
+}
+
+// Validate validates the Ladder
+func (l *Ladder) Validate() error {
+	if l.Decay < 0 {
+		return fmt.Errorf("decay cannot be negative")
+	}
+
+	seen := map[int]bool{}
+	for _, s := range l.Steps {
+		if s.Strikes < 1 {
+			return fmt.Errorf("A step needs at least 1 strike")
+		}
+		if seen[s.Strikes] {
+			return fmt.Errorf("Only one step can be used for %d strikes", s.Strikes)
+		}
+		seen[s.Strikes] = true
+
+		if !ladderActions[s.Action] {
+			return fmt.Errorf("Step action should be one of warn, erase, mute, kick or ban")
+		}
+		if len(s.Message) > 500 {
+			return fmt.Errorf("Step message cannot exceed 500 characters")
+		} else if _, err := template.New("msg").Parse(s.Message); err != nil {
+			return fmt.Errorf("Step message is not a valid template: error %v", err)
+		}
+	}
+
+	return nil
+}
+
+// Save saves the Ladder
+func (l *Ladder) Save(userBucket []byte) error {
+	return db.DB.Update(func(tx *bolt.Tx) error {
+		b, err := json.Marshal(l)
+		if err != nil {
+			return err
+		}
+
+		return buckets.ModerationLadders(tx).Put(userBucket, b)
+	})
+}
+
+// step gets the step with the most strikes that the number of strikes has reached
+func (l *Ladder) step(strikes int) *Step {
+	var step *Step
+	for i, s := range l.Steps {
+		if s.Strikes <= strikes && (step == nil || s.Strikes > step.Strikes) {
+			step = &l.Steps[i]
+		}
+	}
+	return step
+}
+
+// GetLadder gets a user's Ladder
+func GetLadder(userBucket []byte) (*Ladder, error) {
+	l := &Ladder{Steps: []Step{}}
+	err := db.DB.View(func(tx *bolt.Tx) error {
+		b := buckets.ModerationLadders(tx).Get(userBucket)
+		if b == nil {
+			return nil
+		}
+		return json.Unmarshal(b, &l)
+	})
+
+	if err != nil {
+		log.Printf("msg='error-getting-moderation-ladder', error='%v', userBucket='%s'\n", err, string(userBucket))
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// Strike is a single offense
+type Strike struct {
+	Reason string    `json:"reason"`
+	Source string    `json:"source"` // filter:<name> or moderator:<username>
+	Time   time.Time `json:"time"`
+}
+
+// Strikes are a viewer's offenses
+type Strikes struct {
+	UserPublicId string   `json:"userPublicId"`
+	Username     string   `json:"username"`
+	Strikes      []Strike `json:"strikes"`
+}
+
+func (s *Strikes) BucketKey() []byte {
+	return []byte(s.UserPublicId)
+}
+
+// decay removes the strikes older than decay seconds
+func (s *Strikes) decay(decay int) {
+	if decay == 0 {
+		return
+	}
+
+	active := []Strike{}
+	for _, st := range s.Strikes {
+		if time.Since(st.Time) < time.Duration(decay)*time.Second {
+			active = append(active, st)
+		}
+	}
+	s.Strikes = active
+}
+
+// Offense describes why a viewer is getting a strike
+type Offense struct {
+	UserPublicId string
+	Username     string
+	Role         string
+	MessageId    string
+	Reason       string
+	Source       string
+}
+
+// AddStrike adds a strike to the viewer and takes the action of the ladder step the viewer reached. The
+// viewer's number of active strikes is returned.
+func AddStrike(userBucket []byte, cm ChatModerator, o Offense) (int, error) {
+	l, err := GetLadder(userBucket)
+	if err != nil {
+		return 0, err
+	}
+
+	s := &Strikes{UserPublicId: o.UserPublicId}
+	err = db.DB.Update(func(tx *bolt.Tx) error {
+		bkt, err := buckets.ModerationStrikes(tx, userBucket)
+		if err != nil {
+			return err
+		}
+
+		if b := bkt.Get(s.BucketKey()); b != nil {
+			if err := json.Unmarshal(b, &s); err != nil {
+				return err
+			}
+		}
+
+		s.decay(l.Decay)
+		if len(o.Username) > 0 {
+			s.Username = o.Username
+		}
+		s.Strikes = append(s.Strikes, Strike{
+			Reason: o.Reason,
+			Source: o.Source,
+			Time:   time.Now(),
+		})
+
+		b, err := json.Marshal(s)
+		if err != nil {
+			return err
+		}
+		return bkt.Put(s.BucketKey(), b)
+	})
+	if err != nil {
+		log.Printf("msg='error-adding-strike', error='%v', userBucket='%s', userPublicId='%s'\n", err, string(userBucket), o.UserPublicId)
+		return 0, err
+	}
+
+	count := len(s.Strikes)
+	if step := l.step(count); step != nil {
+		if err := step.apply(cm, o, count); err != nil {
+			return count, err
+		}
+	}
+
+	return count, nil
+}
+
+// apply takes the step's action
+func (s *Step) apply(cm ChatModerator, o Offense, strikes int) error {
+	var err error
+	switch s.Action {
+	case ActionErase:
+		if len(o.MessageId) > 0 {
+			err = cm.Erase(o.MessageId)
+		}
+	case ActionMute:
+		if o.Role == "guest" {
+			err = cm.MuteGuest(o.UserPublicId)
+		} else {
+			err = cm.Mute(o.UserPublicId)
+		}
+	case ActionKick:
+		err = cm.Kick(o.UserPublicId)
+	case ActionBan:
+		err = cm.Ban(o.UserPublicId)
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(s.Message) == 0 {
+		return nil
+	}
+
+	t, err := template.New("msg").Parse(s.Message)
+	if err != nil {
+		return err
+	}
+	buf := &bytes.Buffer{}
+	err = t.Execute(buf, map[string]interface{}{
+		"Username": o.Username,
+		"Strikes":  strikes,
+		"Reason":   o.Reason,
+	})
+	if err != nil {
+		return err
+	}
+
+	return cm.Say(buf.String())
+}
+
+// GetStrikes gets a viewer's active strikes
+func GetStrikes(userBucket []byte, userPublicId string) (*Strikes, error) {
+	all, err := GetAllStrikes(userBucket)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, s := range all {
+		if s.UserPublicId == userPublicId {
+			return s, nil
+		}
+	}
+
+	return &Strikes{UserPublicId: userPublicId, Strikes: []Strike{}}, nil
+}
+
+// GetAllStrikes gets the active strikes of every viewer that has any
+func GetAllStrikes(userBucket []byte) ([]*Strikes, error) {
+	l, err := GetLadder(userBucket)
+	if err != nil {
+		return nil, err
+	}
+
+	all := []*Strikes{}
+	err = db.DB.View(func(tx *bolt.Tx) error {
+		bkt, err := buckets.ModerationStrikes(tx, userBucket)
+		if err == buckets.ErrBucketNotFound {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		return bkt.ForEach(func(k, v []byte) error {
+			s := &Strikes{}
+			if err := json.Unmarshal(v, &s); err != nil {
+				log.Printf("msg='json-unmarshal-error', key='%s', error='%v'\n", string(k), err)
+				return nil
+			}
+
+			s.decay(l.Decay)
+			if len(s.Strikes) > 0 {
+				all = append(all, s)
+			}
+			return nil
+		})
+	})
+
+	if err != nil {
+		log.Printf("msg='error-reading-strikes', error='%v', userBucket='%s'\n", err, string(userBucket))
+		return nil, err
+	}
+
+	return all, nil
+}
+
+// ClearStrikes removes all of a viewer's strikes
+func ClearStrikes(userBucket []byte, userPublicId string) error {
+	err := db.DB.Update(func(tx *bolt.Tx) error {
+		bkt, err := buckets.ModerationStrikes(tx, userBucket)
+		if err != nil {
+			return err
+		}
+
+		return bkt.Delete([]byte(userPublicId))
+	})
+
+	if err != nil {
+		log.Printf("msg='error-clearing-strikes', error='%v', userBucket='%s'\n", err, string(userBucket))
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,185 @@
+package moderation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/StreamMeBots/meep/pkg/buckets"
+	"github.com/StreamMeBots/meep/pkg/db"
+
+	"github.com/boltdb/bolt"
+)
+
+// Errors
+var ErrTimeoutNotFound = errors.New("Timeout not found")
+
+// MaxTimeout is the longest a viewer can be timed out for
+var MaxTimeout = time.Hour * 24 * 14
+
+// Timeout is a temporary mute
+type Timeout struct {
+	UserPublicId string    `json:"userPublicId"`
+	Username     string    `json:"username"`
+	Role         string    `json:"role,omitempty"` // the viewer's chat role, guests are muted differently
+	By           string    `json:"by"`             // who timed out the viewer
+	Created      time.Time `json:"created"`
+	Expires      time.Time `json:"expires"`
+}
+
+func (t *Timeout) BucketKey() []byte {
+	return []byte(t.UserPublicId)
+}
+
+// Expired checks if the timeout is over
+func (t *Timeout) Expired() bool {
+	return !time.Now().Before(t.Expires)
+}
+
+// ParseDuration parses a timeout duration. A number without a unit is in seconds.
+func ParseDuration(s string) (time.Duration, error) {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		secs, serr := strconv.Atoi(s)
+		if serr != nil {
+			return 0, fmt.Errorf("'%s' is not a valid duration, try 30s, 10m or 1h", s)
+		}
+		d = time.Duration(secs) * time.Second
+	}
+
+	if d < time.Second || d > MaxTimeout {
+		return 0, fmt.Errorf("A timeout should be between 1s and %v", MaxTimeout)
+	}
+
+	return d, nil
+}
+
+// AddTimeout mutes the viewer and saves the timeout so the viewer can be unmuted when it's over. An existing
+// timeout for the viewer is replaced.
+func AddTimeout(userBucket []byte, cm ChatModerator, t *Timeout) error {
+	var err error
+	if t.Role == "guest" {
+		err = cm.MuteGuest(t.UserPublicId)
+	} else {
+		err = cm.Mute(t.UserPublicId)
+	}
+	if err != nil {
+		return err
+	}
+
+	err = db.DB.Update(func(tx *bolt.Tx) error {
+		b, err := json.Marshal(t)
+		if err != nil {
+			return err
+		}
+
+		bkt, err := buckets.ModerationTimeouts(tx, userBucket)
+		if err != nil {
+			return err
+		}
+
+		return bkt.Put(t.BucketKey(), b)
+	})
+	if err != nil {
+		log.Printf("msg='error-saving-timeout', error='%v', userBucket='%s'\n", err, string(userBucket))
+		return err
+	}
+
+	return nil
+}
+
+// UnMute unmutes a viewer and gives them back the role they had before being muted. Unmuting in chat always makes
+// the viewer a user so guests are changed back to guests.
+func UnMute(cm ChatModerator, userPublicId, role string) error {
+	switch role {
+	case "guest", "mutedGuest":
+		return cm.ChangeRole(userPublicId, "guest")
+	case "", "user", "mute":
+		return cm.UnMute(userPublicId)
+	}
+	return cm.ChangeRole(userPublicId, role)
+}
+
+// EndTimeout unmutes the viewer with the role they had when they were timed out and removes the timeout
+func EndTimeout(userBucket []byte, cm ChatModerator, t *Timeout) error {
+	if err := UnMute(cm, t.UserPublicId, t.Role); err != nil {
+		return err
+	}
+
+	err := db.DB.Update(func(tx *bolt.Tx) error {
+		bkt, err := buckets.ModerationTimeouts(tx, userBucket)
+		if err != nil {
+			return err
+		}
+
+		return bkt.Delete(t.BucketKey())
+	})
+	if err != nil {
+		log.Printf("msg='error-deleting-timeout', error='%v', userBucket='%s'\n", err, string(userBucket))
+		return err
+	}
+
+	return nil
+}
+
+// GetTimeout gets a viewer's timeout
+func GetTimeout(userBucket []byte, userPublicId string) (*Timeout, error) {
+	var t *Timeout
+	err := db.DB.View(func(tx *bolt.Tx) error {
+		bkt, err := buckets.ModerationTimeouts(tx, userBucket)
+		if err == buckets.ErrBucketNotFound {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		b := bkt.Get([]byte(userPublicId))
+		if b == nil {
+			return nil
+		}
+		return json.Unmarshal(b, &t)
+	})
+	if err != nil {
+		log.Printf("msg='error-reading-timeout', error='%v', userBucket='%s'\n", err, string(userBucket))
+		return nil, err
+	}
+
+	if t == nil {
+		return nil, ErrTimeoutNotFound
+	}
+
+	return t, nil
+}
+
+// GetTimeouts gets all of the bot's timeouts, including the ones that are over but have not been unmuted yet
+func GetTimeouts(userBucket []byte) ([]*Timeout, error) {
+	timeouts := []*Timeout{}
+	err := db.DB.View(func(tx *bolt.Tx) error {
+		bkt, err := buckets.ModerationTimeouts(tx, userBucket)
+		if err == buckets.ErrBucketNotFound {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		return bkt.ForEach(func(k, v []byte) error {
+			t := &Timeout{}
+			if err := json.Unmarshal(v, &t); err != nil {
+				log.Printf("msg='json-unmarshal-error', key='%s', error='%v'\n", string(k), err)
+				return nil
+			}
+
+			timeouts = append(timeouts, t)
+			return nil
+		})
+	})
+	if err != nil {
+		log.Printf("msg='error-reading-timeouts', error='%v', userBucket='%s'\n", err, string(userBucket))
+		return nil, err
+	}
+
+	return timeouts, nil
+}
@@ -0,0 +1,381 @@
+/*
+* Package points keeps the loyalty points a bot's viewers earn by watching and chatting. Balances are changed in
+* bolt update transactions, which bolt runs one at a time, so concurrent awards and transfers never lose updates.
+* Every change is written to the bot's ledger in the same transaction.
+ */
+package points
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/StreamMeBots/meep/pkg/buckets"
+	"github.com/StreamMeBots/meep/pkg/db"
+
+	"github.com/boltdb/bolt"
+)
+
+// Errors
+var (
+	ErrInsufficientPoints = errors.New("Not enough points")
+	ErrInvalidAmount      = errors.New("The amount should be more than 0")
+	ErrSameAccount        = errors.New("Points can't be given to yourself")
+)
+
+// ledger reasons
+const (
+	ReasonPresence = "presence"
+	ReasonMessage  = "message"
+	ReasonStreak   = "streak"
+	ReasonGive     = "give"
+	ReasonReceive  = "receive"
+	ReasonAdjust   = "adjust" // changed by a moderator or the streamer
+	ReasonBet      = "bet"
+	ReasonPayout   = "payout"
+	ReasonRefund   = "refund"
+	ReasonTrivia   = "trivia"
+)
+
+// Settings are a bot's points rates
+type Settings struct {
+	Enabled         bool   `json:"enabled"`
+	Currency        string `json:"currency"`        // name of the points, e.g. coins
+	PerMinute       int64  `json:"perMinute"`       // points for each minute a viewer is in chat
+	PerMessage      int64  `json:"perMessage"`      // points for chatting
+	MessageCooldown int    `json:"messageCooldown"` // seconds before chatting earns points again
+	StreakBonus     int64  `json:"streakBonus"`     // points for each visit in a row, see greetings
+}
+
+// DefaultSettings are used until a bot's settings are saved
+var DefaultSettings = Settings{
+	Currency:        "points",
+	PerMinute:       1,
+	PerMessage:      1,
+	MessageCooldown: 60,
+	StreakBonus:     5,
+}
+
+// MaxStreakDays is the most visits in a row the streak bonus is given for
+var MaxStreakDays = 7
+
+// Streak is the bonus for a viewer that has visited days in a row
+func (s *Settings) Streak(days int) int64 {
+	if days > MaxStreakDays {
+		days = MaxStreakDays
+	}
+	return s.StreakBonus * int64(days)
+}
+
+// Validate validates the Settings
+func (s *Settings) Validate() error {
+	if len(s.Currency) == 0 || len(s.Currency) > 30 {
+		return fmt.Errorf("currency should be between 1 and 30 characters")
+	}
+	if s.PerMinute < 0 || s.PerMessage < 0 || s.StreakBonus < 0 || s.MessageCooldown < 0 {
+		return fmt.Errorf("Points rates cannot be negative")
+	}
+	return nil
+}
+
+// Save saves a bot's settings
+func (s *Settings) Save(botBucket []byte) error {
+	err := db.DB.Update(func(tx *bolt.Tx) error {
+		b, err := json.Marshal(s)
+		if err != nil {
+			return err
+		}
+		return buckets.PointsSettings(tx).Put(botBucket, b)
+	})
+	if err != nil {
+		log.Printf("msg='error-saving-points-settings', error='%v', botBucket='%s'\n", err, string(botBucket))
+		return err
+	}
+
+	return nil
+}
+
+// GetSettings gets a bot's settings
+func GetSettings(botBucket []byte) (*Settings, error) {
+	s := DefaultSettings
+	err := db.DB.View(func(tx *bolt.Tx) error {
+		b := buckets.PointsSettings(tx).Get(botBucket)
+		if b == nil {
+			return nil
+		}
+		return json.Unmarshal(b, &s)
+	})
+	if err != nil {
+		log.Printf("msg='error-getting-points-settings', error='%v', botBucket='%s'\n", err, string(botBucket))
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+// Account is a viewer's balance
+type Account struct {
+	UserPublicId string `json:"userPublicId"`
+	Username     string `json:"username"`
+	Balance      int64  `json:"balance"`
+}
+
+// Entry is a change to a viewer's balance
+type Entry struct {
+	Id           uint64    `json:"id"`
+	Time         time.Time `json:"time"`
+	UserPublicId string    `json:"userPublicId"`
+	Username     string    `json:"username"`
+	Amount       int64     `json:"amount"`
+	Balance      int64     `json:"balance"` // the balance after the change
+	Reason       string    `json:"reason"`
+	Note         string    `json:"note,omitempty"` // e.g. who the points were given to
+}
+
+// Change is a change to make to a viewer's balance
+type Change struct {
+	UserPublicId string
+	Username     string
+	Amount       int64
+	Reason       string
+	Note         string
+}
+
+// Apply changes the balances in one transaction. Balances don't go below 0. The new balances are returned in the
+// same order as the changes.
+func Apply(botBucket []byte, changes ...Change) ([]int64, error) {
+	balances := make([]int64, len(changes))
+	err := db.DB.Update(func(tx *bolt.Tx) error {
+		for i, c := range changes {
+			a, err := ApplyTx(tx, botBucket, c, false)
+			if err != nil {
+				return err
+			}
+			balances[i] = a.Balance
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("msg='error-changing-points', error='%v', botBucket='%s'\n", err, string(botBucket))
+		return nil, err
+	}
+
+	return balances, nil
+}
+
+// Transfer moves points from one viewer to another. The sender's new balance is returned.
+func Transfer(botBucket []byte, from, to Account, amount int64) (int64, error) {
+	if amount <= 0 {
+		return 0, ErrInvalidAmount
+	}
+	if from.UserPublicId == to.UserPublicId {
+		return 0, ErrSameAccount
+	}
+
+	var balance int64
+	err := db.DB.Update(func(tx *bolt.Tx) error {
+		a, err := ApplyTx(tx, botBucket, Change{
+			UserPublicId: from.UserPublicId,
+			Username:     from.Username,
+			Amount:       -amount,
+			Reason:       ReasonGive,
+			Note:         to.Username,
+		}, true)
+		if err != nil {
+			return err
+		}
+		balance = a.Balance
+
+		_, err = ApplyTx(tx, botBucket, Change{
+			UserPublicId: to.UserPublicId,
+			Username:     to.Username,
+			Amount:       amount,
+			Reason:       ReasonReceive,
+			Note:         from.Username,
+		}, true)
+		return err
+	})
+	if err != nil {
+		if err != ErrInsufficientPoints {
+			log.Printf("msg='error-transferring-points', error='%v', botBucket='%s'\n", err, string(botBucket))
+		}
+		return 0, err
+	}
+
+	return balance, nil
+}
+
+// ApplyTx changes a balance and writes the ledger entry in the transaction so other packages can change balances
+// together with their own data. If strict is true a change that would make the balance negative fails with
+// ErrInsufficientPoints, otherwise the balance stops at 0.
+func ApplyTx(tx *bolt.Tx, botBucket []byte, c Change, strict bool) (*Account, error) {
+	bkt, err := buckets.Points(tx, botBucket)
+	if err != nil {
+		return nil, err
+	}
+	ledger, err := buckets.PointsLedger(tx, botBucket)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &Account{UserPublicId: c.UserPublicId}
+	if b := bkt.Get([]byte(c.UserPublicId)); b != nil {
+		if err := json.Unmarshal(b, &a); err != nil {
+			return nil, err
+		}
+	}
+	if len(c.Username) > 0 {
+		a.Username = c.Username
+	}
+
+	amount := c.Amount
+	if a.Balance+amount < 0 {
+		if strict {
+			return nil, ErrInsufficientPoints
+		}
+		amount = -a.Balance
+	}
+	a.Balance += amount
+
+	b, err := json.Marshal(a)
+	if err != nil {
+		return nil, err
+	}
+	if err := bkt.Put([]byte(a.UserPublicId), b); err != nil {
+		return nil, err
+	}
+
+	e := &Entry{
+		Time:         time.Now(),
+		UserPublicId: a.UserPublicId,
+		Username:     a.Username,
+		Amount:       amount,
+		Balance:      a.Balance,
+		Reason:       c.Reason,
+		Note:         c.Note,
+	}
+	if e.Id, err = ledger.NextSequence(); err != nil {
+		return nil, err
+	}
+	if b, err = json.Marshal(e); err != nil {
+		return nil, err
+	}
+	return a, ledger.Put(itob(e.Id), b)
+}
+
+// GetAccount gets a viewer's balance
+func GetAccount(botBucket []byte, userPublicId string) (*Account, error) {
+	a := &Account{UserPublicId: userPublicId}
+	err := db.DB.View(func(tx *bolt.Tx) error {
+		bkt, err := buckets.Points(tx, botBucket)
+		if err == buckets.ErrBucketNotFound {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		b := bkt.Get([]byte(userPublicId))
+		if b == nil {
+			return nil
+		}
+		return json.Unmarshal(b, &a)
+	})
+	if err != nil {
+		log.Printf("msg='error-getting-points-account', error='%v', botBucket='%s'\n", err, string(botBucket))
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// GetAccounts gets the balances sorted from highest to lowest, a limit of 0 gets all of them
+func GetAccounts(botBucket []byte, limit int) ([]*Account, error) {
+	accounts := []*Account{}
+	err := db.DB.View(func(tx *bolt.Tx) error {
+		bkt, err := buckets.Points(tx, botBucket)
+		if err == buckets.ErrBucketNotFound {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		return bkt.ForEach(func(k, v []byte) error {
+			a := &Account{}
+			if err := json.Unmarshal(v, &a); err != nil {
+				log.Printf("msg='json-unmarshal-error', key='%s', error='%v'\n", string(k), err)
+				return nil
+			}
+			accounts = append(accounts, a)
+			return nil
+		})
+	})
+	if err != nil {
+		log.Printf("msg='error-getting-points-accounts', error='%v', botBucket='%s'\n", err, string(botBucket))
+		return nil, err
+	}
+
+	sort.Sort(byBalance(accounts))
+	if limit > 0 && len(accounts) > limit {
+		accounts = accounts[:limit]
+	}
+	return accounts, nil
+}
+
+type byBalance []*Account
+
+func (a byBalance) Len() int           { return len(a) }
+func (a byBalance) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byBalance) Less(i, j int) bool { return a[i].Balance > a[j].Balance }
+
+// GetLedger gets ledger entries newest first. Only the viewer's entries are returned if userPublicId is set and
+// entries older than before are returned if before is more than 0.
+func GetLedger(botBucket []byte, userPublicId string, before uint64, limit int) ([]*Entry, error) {
+	entries := []*Entry{}
+	err := db.DB.View(func(tx *bolt.Tx) error {
+		bkt, err := buckets.PointsLedger(tx, botBucket)
+		if err == buckets.ErrBucketNotFound {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		crs := bkt.Cursor()
+		k, v := crs.Last()
+		if before > 0 {
+			// seek goes to the first key >= before, step back to the entry before it
+			if k, v = crs.Seek(itob(before)); k == nil {
+				k, v = crs.Last()
+			} else {
+				k, v = crs.Prev()
+			}
+		}
+
+		for ; k != nil && len(entries) < limit; k, v = crs.Prev() {
+			e := &Entry{}
+			if err := json.Unmarshal(v, &e); err != nil {
+				continue
+			}
+			if len(userPublicId) > 0 && e.UserPublicId != userPublicId {
+				continue
+			}
+			entries = append(entries, e)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("msg='error-getting-points-ledger', error='%v', botBucket='%s'\n", err, string(botBucket))
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+func itob(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
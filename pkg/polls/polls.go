@@ -0,0 +1,243 @@
+/*
+* Package polls runs chat polls and stores the finished ones
+ */
+package polls
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/StreamMeBots/meep/pkg/buckets"
+	"github.com/StreamMeBots/meep/pkg/db"
+
+	"github.com/boltdb/bolt"
+)
+
+// Errors
+var (
+	ErrPollEnded     = errors.New("The poll has ended")
+	ErrAlreadyVoted  = errors.New("Already voted")
+	ErrInvalidOption = errors.New("Invalid option")
+)
+
+// poll limits
+var (
+	DefaultDuration = time.Minute * 2
+	MinDuration     = time.Second * 10
+	MaxDuration     = time.Hour
+	MaxOptions      = 10
+)
+
+// Option is one of a poll's answers
+type Option struct {
+	Text  string `json:"text"`
+	Votes int    `json:"votes"`
+}
+
+// Poll is a question viewers vote on, each viewer gets one vote
+type Poll struct {
+	Id        uint64    `json:"id,omitempty"`
+	Question  string    `json:"question"`
+	Options   []Option  `json:"options"`
+	Duration  int       `json:"duration"` // seconds
+	CreatedBy string    `json:"createdBy,omitempty"`
+	Started   time.Time `json:"started"`
+	Ends      time.Time `json:"ends"`
+	Ended     bool      `json:"ended"`
+
+	mx     sync.Mutex
+	voters map[string]bool
+}
+
+// New creates a poll, a duration of 0 is DefaultDuration
+func New(question string, options []string, d time.Duration, createdBy string) *Poll {
+	if d == 0 {
+		d = DefaultDuration
+	}
+
+	p := &Poll{
+		Question:  strings.TrimSpace(question),
+		Options:   make([]Option, 0, len(options)),
+		Duration:  int(d / time.Second),
+		CreatedBy: createdBy,
+	}
+	for _, o := range options {
+		p.Options = append(p.Options, Option{Text: strings.TrimSpace(o)})
+	}
+	return p
+}
+
+// Validate validates the Poll
+func (p *Poll) Validate() error {
+	if len(p.Question) == 0 || len(p.Question) > 200 {
+		return fmt.Errorf("Poll question should be between 1 and 200 characters")
+	}
+	if len(p.Options) < 2 || len(p.Options) > MaxOptions {
+		return fmt.Errorf("Poll should have between 2 and %d options", MaxOptions)
+	}
+	for _, o := range p.Options {
+		if len(o.Text) == 0 || len(o.Text) > 100 {
+			return fmt.Errorf("Poll options should be between 1 and 100 characters")
+		}
+	}
+	if d := time.Duration(p.Duration) * time.Second; d < MinDuration || d > MaxDuration {
+		return fmt.Errorf("Poll duration should be between %v and %v", MinDuration, MaxDuration)
+	}
+	return nil
+}
+
+// Start starts the poll's voting
+func (p *Poll) Start() {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+
+	p.voters = map[string]bool{}
+	p.Started = time.Now()
+	p.Ends = p.Started.Add(time.Duration(p.Duration) * time.Second)
+}
+
+// Vote votes for the n-th option starting at 1
+func (p *Poll) Vote(userPublicId string, n int) error {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+
+	if p.Ended || time.Now().After(p.Ends) {
+		return ErrPollEnded
+	}
+	if n < 1 || n > len(p.Options) {
+		return ErrInvalidOption
+	}
+	if p.voters[userPublicId] {
+		return ErrAlreadyVoted
+	}
+
+	p.voters[userPublicId] = true
+	p.Options[n-1].Votes++
+	return nil
+}
+
+// End ends the poll's voting
+func (p *Poll) End() {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+
+	p.Ended = true
+	p.voters = nil
+}
+
+// Snapshot returns a copy of the poll that is safe to use while viewers are voting
+func (p *Poll) Snapshot() *Poll {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+
+	return &Poll{
+		Id:        p.Id,
+		Question:  p.Question,
+		Options:   append([]Option{}, p.Options...),
+		Duration:  p.Duration,
+		CreatedBy: p.CreatedBy,
+		Started:   p.Started,
+		Ends:      p.Ends,
+		Ended:     p.Ended,
+	}
+}
+
+// Announcement is the message that starts the poll in chat
+func (p *Poll) Announcement() string {
+	opts := make([]string, len(p.Options))
+	for i, o := range p.Options {
+		opts[i] = fmt.Sprintf("%d) %s", i+1, o.Text)
+	}
+	return fmt.Sprintf("Poll: %s %s - vote with !vote <number>", p.Question, strings.Join(opts, " "))
+}
+
+// Results is the message with the poll's results
+func (p *Poll) Results() string {
+	s := p.Snapshot()
+
+	total := 0
+	for _, o := range s.Options {
+		total += o.Votes
+	}
+	if total == 0 {
+		return fmt.Sprintf("Poll ended: %s - nobody voted", s.Question)
+	}
+
+	best := 0
+	results := make([]string, len(s.Options))
+	for i, o := range s.Options {
+		results[i] = fmt.Sprintf("%s %d%% (%d)", o.Text, o.Votes*100/total, o.Votes)
+		if o.Votes > s.Options[best].Votes {
+			best = i
+		}
+	}
+	return fmt.Sprintf("Poll ended: %s - %s. Winner: %s", s.Question, strings.Join(results, ", "), s.Options[best].Text)
+}
+
+// Save saves a finished poll and gives it the next id
+func (p *Poll) Save(botBucket []byte) error {
+	s := p.Snapshot()
+	err := db.DB.Update(func(tx *bolt.Tx) error {
+		bkt, err := buckets.Polls(tx, botBucket)
+		if err != nil {
+			return err
+		}
+
+		if s.Id, err = bkt.NextSequence(); err != nil {
+			return err
+		}
+		b, err := json.Marshal(s)
+		if err != nil {
+			return err
+		}
+
+		key := make([]byte, 8)
+		binary.BigEndian.PutUint64(key, s.Id)
+		return bkt.Put(key, b)
+	})
+	if err != nil {
+		log.Printf("msg='error-saving-poll', error='%v', botBucket='%s'\n", err, string(botBucket))
+		return err
+	}
+
+	p.mx.Lock()
+	p.Id = s.Id
+	p.mx.Unlock()
+	return nil
+}
+
+// GetAll gets a bot's finished polls, newest first
+func GetAll(botBucket []byte) ([]*Poll, error) {
+	ps := []*Poll{}
+	err := db.DB.View(func(tx *bolt.Tx) error {
+		bkt, err := buckets.Polls(tx, botBucket)
+		if err == buckets.ErrBucketNotFound {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		crs := bkt.Cursor()
+		for k, v := crs.Last(); k != nil; k, v = crs.Prev() {
+			p := &Poll{}
+			if err := json.Unmarshal(v, &p); err != nil {
+				log.Printf("msg='json-unmarshal-error', error='%v'\n", err)
+				continue
+			}
+			ps = append(ps, p)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("msg='error-getting-polls', error='%v', botBucket='%s'\n", err, string(botBucket))
+		return nil, err
+	}
+
+	return ps, nil
+}
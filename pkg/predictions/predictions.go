@@ -0,0 +1,469 @@
+/*
+* Package predictions runs predictions that viewers bet their loyalty points on. Every bet, payout and refund changes
+* the points balances and the prediction in a single bolt transaction, so a prediction's bets always match the
+* points ledger. Each bet is kept on the prediction with what it paid out as the audit record.
+ */
+package predictions
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/StreamMeBots/meep/pkg/buckets"
+	"github.com/StreamMeBots/meep/pkg/db"
+	"github.com/StreamMeBots/meep/pkg/points"
+
+	"github.com/boltdb/bolt"
+)
+
+// Errors
+var (
+	ErrPredictionNotFound = errors.New("Prediction not found")
+	ErrPredictionRunning  = errors.New("A prediction is already running")
+	ErrNoPrediction       = errors.New("There is no prediction running")
+	ErrLocked             = errors.New("Bets are locked")
+	ErrInvalidOutcome     = errors.New("That isn't one of the outcomes")
+	ErrOtherOutcome       = errors.New("You already bet on another outcome")
+)
+
+// prediction states
+const (
+	StateOpen     = "open"   // viewers can bet
+	StateLocked   = "locked" // bets are locked, waiting for the outcome
+	StateResolved = "resolved"
+	StateRefunded = "refunded"
+)
+
+// MaxOutcomes is the most outcomes a prediction can have
+var MaxOutcomes = 10
+
+// MaxWindow is the longest a prediction can take bets for
+var MaxWindow = time.Hour
+
+// Outcome is a possible outcome of a prediction
+type Outcome struct {
+	Text    string `json:"text"`
+	Total   int64  `json:"total"`   // points bet on the outcome
+	Bettors int    `json:"bettors"` // viewers that bet on the outcome
+}
+
+// Bet is a viewer's bet
+type Bet struct {
+	UserPublicId string    `json:"userPublicId"`
+	Username     string    `json:"username"`
+	Outcome      int       `json:"outcome"` // 1 based
+	Amount       int64     `json:"amount"`
+	Payout       int64     `json:"payout"` // points paid back when the prediction was resolved or refunded
+	Time         time.Time `json:"time"`
+}
+
+// Prediction is a question viewers bet on the outcome of
+type Prediction struct {
+	Id        uint64     `json:"id"`
+	Title     string     `json:"title"`
+	Outcomes  []*Outcome `json:"outcomes"`
+	Window    int        `json:"window"` // seconds bets are taken for, 0 takes bets until a moderator locks them
+	CreatedBy string     `json:"createdBy"`
+	State     string     `json:"state"`
+	Created   time.Time  `json:"created"`
+	Locks     time.Time  `json:"locks,omitempty"` // when the window ends
+	Locked    time.Time  `json:"locked,omitempty"`
+	Resolved  time.Time  `json:"resolved,omitempty"`
+	Winner    int        `json:"winner"` // the outcome that won, 0 if refunded
+	Bets      []*Bet     `json:"bets"`
+}
+
+// New is the constructor for Prediction
+func New(title string, outcomes []string, window time.Duration, createdBy string) *Prediction {
+	p := &Prediction{
+		Title:     title,
+		Outcomes:  make([]*Outcome, len(outcomes)),
+		Window:    int(window / time.Second),
+		CreatedBy: createdBy,
+	}
+	for i, o := range outcomes {
+		p.Outcomes[i] = &Outcome{Text: o}
+	}
+	return p
+}
+
+// Validate validates the Prediction
+func (p *Prediction) Validate() error {
+	if len(p.Title) == 0 || len(p.Title) > 200 {
+		return fmt.Errorf("Prediction title should be between 1 and 200 characters")
+	}
+	if len(p.Outcomes) < 2 || len(p.Outcomes) > MaxOutcomes {
+		return fmt.Errorf("Predictions should have between 2 and %d outcomes", MaxOutcomes)
+	}
+	for _, o := range p.Outcomes {
+		if o == nil || len(o.Text) == 0 || len(o.Text) > 100 {
+			return fmt.Errorf("Prediction outcomes should be between 1 and 100 characters")
+		}
+	}
+	if p.Window < 0 || time.Duration(p.Window)*time.Second > MaxWindow {
+		return fmt.Errorf("Prediction window should be between 0 and %d seconds", int(MaxWindow/time.Second))
+	}
+	return nil
+}
+
+// Active reports if the prediction hasn't been resolved or refunded yet
+func (p *Prediction) Active() bool {
+	return p.State == StateOpen || p.State == StateLocked
+}
+
+// Pool is the points bet on all the outcomes
+func (p *Prediction) Pool() int64 {
+	var pool int64
+	for _, o := range p.Outcomes {
+		pool += o.Total
+	}
+	return pool
+}
+
+// Outcome finds an outcome by its number or text, 0 is returned if there isn't one
+func (p *Prediction) Outcome(s string) int {
+	if n, err := strconv.Atoi(s); err == nil {
+		if n < 1 || n > len(p.Outcomes) {
+			return 0
+		}
+		return n
+	}
+	for i, o := range p.Outcomes {
+		if strings.EqualFold(o.Text, s) {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// Announcement is the chat message that opens the prediction
+func (p *Prediction) Announcement() string {
+	outcomes := make([]string, len(p.Outcomes))
+	for i, o := range p.Outcomes {
+		outcomes[i] = fmt.Sprintf("%d) %s", i+1, o.Text)
+	}
+	return fmt.Sprintf("Prediction: %s %s - bet with !bet <outcome> <amount>", p.Title, strings.Join(outcomes, " "))
+}
+
+// Open saves a new prediction and opens it for bets. Only one prediction can run at a time.
+func Open(botBucket []byte, p *Prediction) error {
+	err := db.DB.Update(func(tx *bolt.Tx) error {
+		bkt, err := buckets.Predictions(tx, botBucket)
+		if err != nil {
+			return err
+		}
+
+		if _, err := active(bkt); err == nil {
+			return ErrPredictionRunning
+		} else if err != ErrNoPrediction {
+			return err
+		}
+
+		if p.Id, err = bkt.NextSequence(); err != nil {
+			return err
+		}
+		p.State = StateOpen
+		p.Created = time.Now()
+		if p.Window > 0 {
+			p.Locks = p.Created.Add(time.Duration(p.Window) * time.Second)
+		}
+		p.Bets = []*Bet{}
+		return put(bkt, p)
+	})
+	if err != nil {
+		if err != ErrPredictionRunning {
+			log.Printf("msg='error-opening-prediction', error='%v', botBucket='%s'\n", err, string(botBucket))
+		}
+		return err
+	}
+
+	return nil
+}
+
+// PlaceBet takes a viewer's points and bets them on an outcome. Viewers can add to their bet but can't bet on more
+// than one outcome.
+func PlaceBet(botBucket []byte, userPublicId, username string, outcome int, amount int64) (*Prediction, error) {
+	if amount <= 0 {
+		return nil, points.ErrInvalidAmount
+	}
+
+	return update(botBucket, func(tx *bolt.Tx, p *Prediction) error {
+		if p.State != StateOpen || (!p.Locks.IsZero() && time.Now().After(p.Locks)) {
+			return ErrLocked
+		}
+		if outcome < 1 || outcome > len(p.Outcomes) {
+			return ErrInvalidOutcome
+		}
+
+		var bet *Bet
+		for _, b := range p.Bets {
+			if b.UserPublicId == userPublicId {
+				bet = b
+				break
+			}
+		}
+		if bet != nil && bet.Outcome != outcome {
+			return ErrOtherOutcome
+		}
+
+		_, err := points.ApplyTx(tx, botBucket, points.Change{
+			UserPublicId: userPublicId,
+			Username:     username,
+			Amount:       -amount,
+			Reason:       points.ReasonBet,
+			Note:         fmt.Sprintf("prediction #%d", p.Id),
+		}, true)
+		if err != nil {
+			return err
+		}
+
+		o := p.Outcomes[outcome-1]
+		if bet == nil {
+			bet = &Bet{UserPublicId: userPublicId, Username: username, Outcome: outcome}
+			p.Bets = append(p.Bets, bet)
+			o.Bettors++
+		}
+		bet.Amount += amount
+		bet.Time = time.Now()
+		o.Total += amount
+		return nil
+	})
+}
+
+// Lock stops the running prediction taking bets. If id isn't 0 the running prediction has to be that prediction.
+func Lock(botBucket []byte, id uint64) (*Prediction, error) {
+	return update(botBucket, func(tx *bolt.Tx, p *Prediction) error {
+		if id != 0 && p.Id != id {
+			return ErrNoPrediction
+		}
+		if p.State != StateOpen {
+			return ErrLocked
+		}
+		p.State = StateLocked
+		p.Locked = time.Now()
+		return nil
+	})
+}
+
+// Resolve ends the running prediction and pays the winners. The whole pool is split between the winners by how much
+// they bet, rounded down. If nobody bet on the winning outcome everyone is refunded.
+func Resolve(botBucket []byte, outcome int) (*Prediction, error) {
+	return update(botBucket, func(tx *bolt.Tx, p *Prediction) error {
+		if outcome < 1 || outcome > len(p.Outcomes) {
+			return ErrInvalidOutcome
+		}
+
+		winners := p.Outcomes[outcome-1].Total
+		if winners == 0 {
+			return refund(tx, botBucket, p)
+		}
+
+		pool := big.NewInt(p.Pool())
+		for _, b := range p.Bets {
+			if b.Outcome != outcome {
+				continue
+			}
+
+			payout := new(big.Int).Mul(big.NewInt(b.Amount), pool)
+			b.Payout = payout.Div(payout, big.NewInt(winners)).Int64()
+			_, err := points.ApplyTx(tx, botBucket, points.Change{
+				UserPublicId: b.UserPublicId,
+				Username:     b.Username,
+				Amount:       b.Payout,
+				Reason:       points.ReasonPayout,
+				Note:         fmt.Sprintf("prediction #%d", p.Id),
+			}, true)
+			if err != nil {
+				return err
+			}
+		}
+
+		p.end(StateResolved)
+		p.Winner = outcome
+		return nil
+	})
+}
+
+// Refund ends the running prediction and gives everyone their points back
+func Refund(botBucket []byte) (*Prediction, error) {
+	return update(botBucket, func(tx *bolt.Tx, p *Prediction) error {
+		return refund(tx, botBucket, p)
+	})
+}
+
+func refund(tx *bolt.Tx, botBucket []byte, p *Prediction) error {
+	for _, b := range p.Bets {
+		b.Payout = b.Amount
+		_, err := points.ApplyTx(tx, botBucket, points.Change{
+			UserPublicId: b.UserPublicId,
+			Username:     b.Username,
+			Amount:       b.Payout,
+			Reason:       points.ReasonRefund,
+			Note:         fmt.Sprintf("prediction #%d", p.Id),
+		}, true)
+		if err != nil {
+			return err
+		}
+	}
+
+	p.end(StateRefunded)
+	return nil
+}
+
+func (p *Prediction) end(state string) {
+	p.Resolved = time.Now()
+	if p.Locked.IsZero() {
+		p.Locked = p.Resolved
+	}
+	p.State = state
+}
+
+// update changes the running prediction and saves it in one transaction
+func update(botBucket []byte, fn func(*bolt.Tx, *Prediction) error) (*Prediction, error) {
+	var p *Prediction
+	err := db.DB.Update(func(tx *bolt.Tx) error {
+		bkt, err := buckets.Predictions(tx, botBucket)
+		if err != nil {
+			return err
+		}
+
+		if p, err = active(bkt); err != nil {
+			return err
+		}
+		if err := fn(tx, p); err != nil {
+			return err
+		}
+		return put(bkt, p)
+	})
+	if err != nil {
+		switch err {
+		case ErrNoPrediction, ErrLocked, ErrInvalidOutcome, ErrOtherOutcome, points.ErrInsufficientPoints:
+		default:
+			log.Printf("msg='error-updating-prediction', error='%v', botBucket='%s'\n", err, string(botBucket))
+		}
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// active gets the running prediction, which is always the latest one
+func active(bkt buckets.Bucket) (*Prediction, error) {
+	_, v := bkt.Cursor().Last()
+	if v == nil {
+		return nil, ErrNoPrediction
+	}
+
+	p := &Prediction{}
+	if err := json.Unmarshal(v, &p); err != nil {
+		return nil, err
+	}
+	if !p.Active() {
+		return nil, ErrNoPrediction
+	}
+	return p, nil
+}
+
+func put(bkt buckets.Bucket, p *Prediction) error {
+	b, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	return bkt.Put(itob(p.Id), b)
+}
+
+// Active gets the running prediction
+func Active(botBucket []byte) (*Prediction, error) {
+	var p *Prediction
+	err := db.DB.View(func(tx *bolt.Tx) error {
+		bkt, err := buckets.Predictions(tx, botBucket)
+		if err == buckets.ErrBucketNotFound {
+			return ErrNoPrediction
+		} else if err != nil {
+			return err
+		}
+
+		p, err = active(bkt)
+		return err
+	})
+	if err != nil {
+		if err != ErrNoPrediction {
+			log.Printf("msg='error-getting-active-prediction', error='%v', botBucket='%s'\n", err, string(botBucket))
+		}
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// Get gets a prediction with its bets
+func Get(botBucket []byte, id uint64) (*Prediction, error) {
+	var p *Prediction
+	err := db.DB.View(func(tx *bolt.Tx) error {
+		bkt, err := buckets.Predictions(tx, botBucket)
+		if err == buckets.ErrBucketNotFound {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		b := bkt.Get(itob(id))
+		if b == nil {
+			return nil
+		}
+		return json.Unmarshal(b, &p)
+	})
+	if err != nil {
+		log.Printf("msg='error-getting-prediction', error='%v', botBucket='%s', id='%d'\n", err, string(botBucket), id)
+		return nil, err
+	}
+
+	if p == nil {
+		return nil, ErrPredictionNotFound
+	}
+	return p, nil
+}
+
+// GetAll gets a bot's predictions without their bets, newest first
+func GetAll(botBucket []byte) ([]*Prediction, error) {
+	ps := []*Prediction{}
+	err := db.DB.View(func(tx *bolt.Tx) error {
+		bkt, err := buckets.Predictions(tx, botBucket)
+		if err == buckets.ErrBucketNotFound {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		crs := bkt.Cursor()
+		for k, v := crs.Last(); k != nil; k, v = crs.Prev() {
+			p := &Prediction{}
+			if err := json.Unmarshal(v, &p); err != nil {
+				log.Printf("msg='json-unmarshal-error', error='%v'\n", err)
+				continue
+			}
+			p.Bets = nil
+			ps = append(ps, p)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("msg='error-getting-predictions', error='%v', botBucket='%s'\n", err, string(botBucket))
+		return nil, err
+	}
+
+	return ps, nil
+}
+
+func itob(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
@@ -0,0 +1,313 @@
+/*
+* Package quotes stores the quotes a bot's moderators save from chat
+ */
+package quotes
+
+import (
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/StreamMeBots/meep/pkg/buckets"
+	"github.com/StreamMeBots/meep/pkg/db"
+
+	"github.com/boltdb/bolt"
+)
+
+// Errors
+var (
+	ErrQuoteNotFound = errors.New("Quote not found")
+	ErrInvalidCSV    = errors.New("CSV should have a header row with a text column")
+)
+
+// MaxImport is the most quotes that can be imported at once
+var MaxImport = 10000
+
+// CSVHeader are the columns of exported CSV files
+var CSVHeader = []string{"id", "text", "addedBy", "created", "category"}
+
+// Quote is something said on stream
+type Quote struct {
+	Id       uint64    `json:"id"`
+	Text     string    `json:"text"`
+	AddedBy  string    `json:"addedBy"`
+	Created  time.Time `json:"created"`
+	Category string    `json:"category,omitempty"` // e.g. the game being played
+}
+
+// BucketKey returns the quote's key, ids are big endian so the quotes are sorted by id
+func (q *Quote) BucketKey() []byte {
+	return itob(q.Id)
+}
+
+// Validate validates the Quote
+func (q *Quote) Validate() error {
+	if len(q.Text) == 0 || len(q.Text) > 500 {
+		return fmt.Errorf("Quote text should be between 1 and 500 characters")
+	}
+	if len(q.AddedBy) > 100 {
+		return fmt.Errorf("Quote addedBy cannot exceed 100 characters")
+	}
+	if len(q.Category) > 100 {
+		return fmt.Errorf("Quote category cannot exceed 100 characters")
+	}
+	return nil
+}
+
+// matches checks if the quote's text or category contains the word
+func (q *Quote) matches(word string) bool {
+	word = strings.ToLower(word)
+	return strings.Contains(strings.ToLower(q.Text), word) || strings.Contains(strings.ToLower(q.Category), word)
+}
+
+// Add saves a new quote and gives it the next id
+func Add(botBucket []byte, q *Quote) error {
+	return Import(botBucket, []*Quote{q})
+}
+
+// Import saves new quotes in one transaction, each quote is given the next id
+func Import(botBucket []byte, qs []*Quote) error {
+	err := db.DB.Update(func(tx *bolt.Tx) error {
+		bkt, err := buckets.Quotes(tx, botBucket)
+		if err != nil {
+			return err
+		}
+
+		for _, q := range qs {
+			if q.Id, err = bkt.NextSequence(); err != nil {
+				return err
+			}
+			if q.Created.IsZero() {
+				q.Created = time.Now()
+			}
+
+			b, err := json.Marshal(q)
+			if err != nil {
+				return err
+			}
+			if err := bkt.Put(q.BucketKey(), b); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("msg='error-saving-quotes', error='%v', botBucket='%s'\n", err, string(botBucket))
+		return err
+	}
+
+	return nil
+}
+
+// Get gets a quote
+func Get(botBucket []byte, id uint64) (*Quote, error) {
+	var q *Quote
+	err := view(botBucket, func(bkt buckets.Bucket) error {
+		b := bkt.Get(itob(id))
+		if b == nil {
+			return nil
+		}
+		return json.Unmarshal(b, &q)
+	})
+	if err != nil {
+		log.Printf("msg='error-getting-quote', error='%v', botBucket='%s', id='%d'\n", err, string(botBucket), id)
+		return nil, err
+	}
+
+	if q == nil {
+		return nil, ErrQuoteNotFound
+	}
+	return q, nil
+}
+
+// Random gets a random quote
+func Random(botBucket []byte) (*Quote, error) {
+	var q *Quote
+	err := view(botBucket, func(bkt buckets.Bucket) error {
+		n := bkt.Stats().KeyN
+		if n == 0 {
+			return nil
+		}
+
+		i := rand.Intn(n)
+		crs := bkt.Cursor()
+		for k, v := crs.First(); k != nil; k, v = crs.Next() {
+			if i > 0 {
+				i--
+				continue
+			}
+			return json.Unmarshal(v, &q)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("msg='error-getting-random-quote', error='%v', botBucket='%s'\n", err, string(botBucket))
+		return nil, err
+	}
+
+	if q == nil {
+		return nil, ErrQuoteNotFound
+	}
+	return q, nil
+}
+
+// Search gets the quotes whose text or category contains the word
+func Search(botBucket []byte, word string) ([]*Quote, error) {
+	qs, err := GetAll(botBucket)
+	if err != nil {
+		return nil, err
+	}
+
+	found := []*Quote{}
+	for _, q := range qs {
+		if q.matches(word) {
+			found = append(found, q)
+		}
+	}
+	return found, nil
+}
+
+// GetAll gets all of a bot's quotes sorted by id
+func GetAll(botBucket []byte) ([]*Quote, error) {
+	qs := []*Quote{}
+	err := view(botBucket, func(bkt buckets.Bucket) error {
+		return bkt.ForEach(func(k, v []byte) error {
+			q := &Quote{}
+			if err := json.Unmarshal(v, &q); err != nil {
+				log.Printf("msg='json-unmarshal-error', key='%d', error='%v'\n", btoi(k), err)
+				return nil
+			}
+			qs = append(qs, q)
+			return nil
+		})
+	})
+	if err != nil {
+		log.Printf("msg='error-getting-quotes', error='%v', botBucket='%s'\n", err, string(botBucket))
+		return nil, err
+	}
+
+	return qs, nil
+}
+
+// Delete deletes a quote
+func Delete(botBucket []byte, id uint64) error {
+	err := db.DB.Update(func(tx *bolt.Tx) error {
+		bkt, err := buckets.Quotes(tx, botBucket)
+		if err != nil {
+			return err
+		}
+
+		if bkt.Get(itob(id)) == nil {
+			return ErrQuoteNotFound
+		}
+		return bkt.Delete(itob(id))
+	})
+	if err != nil && err != ErrQuoteNotFound {
+		log.Printf("msg='error-deleting-quote', error='%v', botBucket='%s', id='%d'\n", err, string(botBucket), id)
+	}
+
+	return err
+}
+
+// WriteCSV writes the quotes as CSV with a CSVHeader row
+func WriteCSV(w io.Writer, qs []*Quote) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(CSVHeader); err != nil {
+		return err
+	}
+
+	for _, q := range qs {
+		err := cw.Write([]string{
+			strconv.FormatUint(q.Id, 10),
+			q.Text,
+			q.AddedBy,
+			q.Created.Format(time.RFC3339),
+			q.Category,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// ReadCSV reads quotes from CSV. The first row is a header naming the columns, only the text column is required.
+// Ids are ignored since imported quotes are given new ids.
+func ReadCSV(r io.Reader) ([]*Quote, error) {
+	rows, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, ErrInvalidCSV
+	}
+
+	cols := map[string]int{}
+	for i, name := range rows[0] {
+		cols[strings.TrimSpace(name)] = i
+	}
+	if _, ok := cols["text"]; !ok {
+		return nil, ErrInvalidCSV
+	}
+
+	get := func(row []string, name string) string {
+		i, ok := cols[name]
+		if !ok || i >= len(row) {
+			return ""
+		}
+		return row[i]
+	}
+
+	qs := []*Quote{}
+	for i, row := range rows[1:] {
+		q := &Quote{
+			Text:     get(row, "text"),
+			AddedBy:  get(row, "addedBy"),
+			Category: get(row, "category"),
+		}
+		if c := get(row, "created"); len(c) > 0 {
+			if q.Created, err = time.Parse(time.RFC3339, c); err != nil {
+				return nil, fmt.Errorf("Row %d has an invalid created time, it should be in RFC3339 format", i+2)
+			}
+		}
+		qs = append(qs, q)
+	}
+
+	return qs, nil
+}
+
+// view is a helper for reading a bot's quotes bucket, fn is not called if the bucket doesn't exist yet
+func view(botBucket []byte, fn func(bkt buckets.Bucket) error) error {
+	return db.DB.View(func(tx *bolt.Tx) error {
+		bkt, err := buckets.Quotes(tx, botBucket)
+		if err == buckets.ErrBucketNotFound {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		return fn(bkt)
+	})
+}
+
+func itob(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
+
+func btoi(b []byte) uint64 {
+	if len(b) != 8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(b)
+}
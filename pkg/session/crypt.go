@@ -0,0 +1,110 @@
+package session
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+
+	"github.com/StreamMeBots/meep/pkg/config"
+)
+
+// gcm creates an AES-GCM cipher from the configured session key
+func gcm() (cipher.AEAD, error) {
+	if len(config.Conf.SessionKey) == 0 {
+		return nil, ErrNoSessionKey
+	}
+
+	// hash the key so any length of secret can be configured
+	key := sha256.Sum256([]byte(config.Conf.SessionKey))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// encrypt seals b, the nonce is prepended to the result
+func encrypt(b []byte) ([]byte, error) {
+	aead, err := gcm()
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(nonce, nonce, b, nil), nil
+}
+
+// decrypt opens b that was sealed by encrypt
+func decrypt(b []byte) ([]byte, error) {
+	aead, err := gcm()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(b) < aead.NonceSize() {
+		return nil, ErrCipherTooShort
+	}
+
+	nonce, b := b[:aead.NonceSize()], b[aead.NonceSize():]
+	return aead.Open(nil, nonce, b, nil)
+}
+
+// CheckKey checks that a session key has been configured
+func CheckKey() error {
+	_, err := gcm()
+	return err
+}
+
+// Sign signs b with the session key. The result can be checked with Verify.
+func Sign(b []byte) (string, error) {
+	if len(config.Conf.SessionKey) == 0 {
+		return "", ErrNoSessionKey
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b) + "." + base64.RawURLEncoding.EncodeToString(mac(b)), nil
+}
+
+// Verify checks a value created by Sign and returns the signed bytes
+func Verify(signed string) ([]byte, error) {
+	if len(config.Conf.SessionKey) == 0 {
+		return nil, ErrNoSessionKey
+	}
+
+	parts := strings.SplitN(signed, ".", 2)
+	if len(parts) != 2 {
+		return nil, ErrInvalidSignature
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrInvalidSignature
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrInvalidSignature
+	}
+
+	if !hmac.Equal(sig, mac(b)) {
+		return nil, ErrInvalidSignature
+	}
+
+	return b, nil
+}
+
+// mac creates an HMAC of b using a key derived from the session key
+func mac(b []byte) []byte {
+	// use a different key than the one used for encryption
+	key := sha256.Sum256([]byte("sign:" + config.Conf.SessionKey))
+	h := hmac.New(sha256.New, key[:])
+	h.Write(b)
+	return h.Sum(nil)
+}
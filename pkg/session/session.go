@@ -0,0 +1,342 @@
+/*
+* Package session persists user sessions and their encrypted oauth2 tokens
+ */
+package session
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/StreamMeBots/meep/pkg/buckets"
+	"github.com/StreamMeBots/meep/pkg/db"
+
+	"github.com/boltdb/bolt"
+	"golang.org/x/oauth2"
+)
+
+// Errors
+var (
+	ErrNotFound         = errors.New("Session not found")
+	ErrNoSessionKey     = errors.New("A session key is required to encrypt tokens")
+	ErrCipherTooShort   = errors.New("Encrypted token is too short")
+	ErrInvalidSignature = errors.New("Invalid signature")
+)
+
+// Duration is how long a session lasts
+var Duration = time.Hour * 24 * 30
+
+// Session represents a logged in user
+type Session struct {
+	Id           string    `json:"-"`  // secret session id used in the sessid cookie
+	PublicId     string    `json:"id"` // id that can be shown to the user
+	UserPublicId string    `json:"userPublicId"`
+	UserAgent    string    `json:"userAgent"`
+	IP           string    `json:"ip"`
+	Created      time.Time `json:"created"`
+	Expires      time.Time `json:"expires"`
+
+	mx    sync.Mutex
+	token *oauth2.Token
+}
+
+// record is how a Session is saved
+type record struct {
+	Id           string    `json:"id"`
+	PublicId     string    `json:"publicId"`
+	UserPublicId string    `json:"userPublicId"`
+	UserAgent    string    `json:"userAgent"`
+	IP           string    `json:"ip"`
+	Created      time.Time `json:"created"`
+	Expires      time.Time `json:"expires"`
+	Token        []byte    `json:"token"` // encrypted JSON oauth2 token
+}
+
+// New is the constructor for Session
+func New(userPublicId, userAgent, ip string, tok *oauth2.Token) (*Session, error) {
+	id, err := RandomId(32)
+	if err != nil {
+		return nil, err
+	}
+	publicId, err := RandomId(8)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Session{
+		Id:           id,
+		PublicId:     publicId,
+		UserPublicId: userPublicId,
+		UserAgent:    userAgent,
+		IP:           ip,
+		Created:      time.Now(),
+		Expires:      time.Now().Add(Duration),
+		token:        tok,
+	}, nil
+}
+
+func (s *Session) BucketKey() []byte {
+	return []byte(s.Id)
+}
+
+// Expired checks if the session has expired
+func (s *Session) Expired() bool {
+	return time.Now().After(s.Expires)
+}
+
+// Token returns the session's last known oauth2 token
+func (s *Session) Token() *oauth2.Token {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	return s.token
+}
+
+// Save saves the session
+func (s *Session) Save() error {
+	err := db.DB.Update(func(tx *bolt.Tx) error {
+		return s.put(tx)
+	})
+	if err != nil {
+		log.Printf("msg='error-saving-session', error='%v', userPublicId='%s'\n", err, s.UserPublicId)
+		return err
+	}
+
+	return nil
+}
+
+func (s *Session) put(tx *bolt.Tx) error {
+	tok, err := json.Marshal(s.Token())
+	if err != nil {
+		return err
+	}
+	tok, err = encrypt(tok)
+	if err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(record{
+		Id:           s.Id,
+		PublicId:     s.PublicId,
+		UserPublicId: s.UserPublicId,
+		UserAgent:    s.UserAgent,
+		IP:           s.IP,
+		Created:      s.Created,
+		Expires:      s.Expires,
+		Token:        tok,
+	})
+	if err != nil {
+		return err
+	}
+
+	return buckets.UserSessions(tx).Put(s.BucketKey(), b)
+}
+
+// setToken updates the session's token and saves it if it changed
+func (s *Session) setToken(tok *oauth2.Token) {
+	s.mx.Lock()
+	changed := s.token == nil || s.token.AccessToken != tok.AccessToken
+	s.token = tok
+	s.mx.Unlock()
+
+	if !changed {
+		return
+	}
+
+	// only update the session if it still exists so a revoked session stays revoked
+	err := db.DB.Update(func(tx *bolt.Tx) error {
+		if buckets.UserSessions(tx).Get(s.BucketKey()) == nil {
+			return nil
+		}
+		return s.put(tx)
+	})
+	if err != nil {
+		log.Printf("msg='error-saving-session-token', error='%v', userPublicId='%s'\n", err, s.UserPublicId)
+	}
+}
+
+// TokenSource returns a TokenSource that refreshes the session's token and saves the refreshed token
+func (s *Session) TokenSource(conf *oauth2.Config) oauth2.TokenSource {
+	tok := s.Token()
+	return oauth2.ReuseTokenSource(tok, &savingTokenSource{
+		src:  conf.TokenSource(oauth2.NoContext, tok),
+		sess: s,
+	})
+}
+
+// savingTokenSource saves every token it hands out to the session
+type savingTokenSource struct {
+	src  oauth2.TokenSource
+	sess *Session
+}
+
+func (ts *savingTokenSource) Token() (*oauth2.Token, error) {
+	tok, err := ts.src.Token()
+	if err != nil {
+		return nil, err
+	}
+	ts.sess.setToken(tok)
+	return tok, nil
+}
+
+// Get gets a session by its secret id. Expired sessions are not returned.
+func Get(id string) (*Session, error) {
+	var s *Session
+	err := db.DB.View(func(tx *bolt.Tx) error {
+		b := buckets.UserSessions(tx).Get([]byte(id))
+		if b == nil {
+			return nil
+		}
+
+		var err error
+		s, err = decode(b)
+		return err
+	})
+	if err != nil {
+		log.Printf("msg='error-getting-session', error='%v'\n", err)
+		return nil, err
+	}
+
+	if s == nil || s.Expired() {
+		return nil, ErrNotFound
+	}
+
+	return s, nil
+}
+
+// GetByUser gets all of a user's active sessions
+func GetByUser(userPublicId string) ([]*Session, error) {
+	sessions := []*Session{}
+	err := forEach(func(s *Session) error {
+		if s.UserPublicId == userPublicId && !s.Expired() {
+			sessions = append(sessions, s)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("msg='error-getting-user-sessions', error='%v', userPublicId='%s'\n", err, userPublicId)
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// Latest gets a user's most recently created active session
+func Latest(userPublicId string) (*Session, error) {
+	sessions, err := GetByUser(userPublicId)
+	if err != nil {
+		return nil, err
+	}
+
+	var latest *Session
+	for _, s := range sessions {
+		if latest == nil || s.Created.After(latest.Created) {
+			latest = s
+		}
+	}
+
+	if latest == nil {
+		return nil, ErrNotFound
+	}
+
+	return latest, nil
+}
+
+// Delete deletes a session by its secret id
+func Delete(id string) error {
+	err := db.DB.Update(func(tx *bolt.Tx) error {
+		return buckets.UserSessions(tx).Delete([]byte(id))
+	})
+	if err != nil {
+		log.Printf("msg='error-deleting-session', error='%v'\n", err)
+		return err
+	}
+
+	return nil
+}
+
+// DeleteExpired deletes all expired sessions and returns the secret ids that were deleted
+func DeleteExpired() ([]string, error) {
+	ids := []string{}
+	err := db.DB.Update(func(tx *bolt.Tx) error {
+		bkt := buckets.UserSessions(tx)
+		crs := bkt.Cursor()
+		for k, v := crs.First(); k != nil; k, v = crs.Next() {
+			r := record{}
+			if err := json.Unmarshal(v, &r); err != nil {
+				log.Printf("msg='json-unmarshal-error', error='%v'\n", err)
+				continue
+			}
+			if time.Now().After(r.Expires) {
+				ids = append(ids, string(k))
+			}
+		}
+
+		for _, id := range ids {
+			if err := bkt.Delete([]byte(id)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("msg='error-deleting-expired-sessions', error='%v'\n", err)
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+// forEach calls fn for every saved session
+func forEach(fn func(*Session) error) error {
+	return db.DB.View(func(tx *bolt.Tx) error {
+		return buckets.UserSessions(tx).ForEach(func(k, v []byte) error {
+			s, err := decode(v)
+			if err != nil {
+				log.Printf("msg='error-decoding-session', error='%v'\n", err)
+				return nil
+			}
+			return fn(s)
+		})
+	})
+}
+
+// decode decodes a saved session and decrypts its token
+func decode(b []byte) (*Session, error) {
+	r := record{}
+	if err := json.Unmarshal(b, &r); err != nil {
+		return nil, err
+	}
+
+	tok, err := decrypt(r.Token)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Session{
+		Id:           r.Id,
+		PublicId:     r.PublicId,
+		UserPublicId: r.UserPublicId,
+		UserAgent:    r.UserAgent,
+		IP:           r.IP,
+		Created:      r.Created,
+		Expires:      r.Expires,
+	}
+	if err := json.Unmarshal(tok, &s.token); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// RandomId creates a hex encoded random id from n random bytes
+func RandomId(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,155 @@
+package stats
+
+import (
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/StreamMeBots/meep/pkg/buckets"
+	"github.com/StreamMeBots/meep/pkg/db"
+
+	"github.com/boltdb/bolt"
+)
+
+// metrics
+const (
+	MetricLines    = "lines"
+	MetricCommands = "commands"
+)
+
+// periods
+const (
+	PeriodHour = "hour"
+	PeriodDay  = "day"
+)
+
+// Row is the count of a metric for an hour or a day
+type Row struct {
+	Metric  string    `json:"metric"`
+	Command string    `json:"command,omitempty"` // the command of a commands row
+	Period  string    `json:"period"`
+	Time    time.Time `json:"time"` // the start of the period
+	Count   int64     `json:"count"`
+}
+
+// CSVHeader are the columns of exported CSV files
+var CSVHeader = []string{"metric", "command", "period", "time", "count"}
+
+// CSV is the row's CSVHeader columns
+func (r *Row) CSV() []string {
+	return []string{r.Metric, r.Command, r.Period, r.Time.Format(time.RFC3339), strconv.FormatInt(r.Count, 10)}
+}
+
+// ExportBatch is the number of rows read in each transaction of an export
+var ExportBatch = 1000
+
+// Export calls fn with each of the bot's stats between from and to, a zero time isn't checked. Lines come first
+// then each command, every metric by day then by hour. The rows are read in batches and fn is called between the
+// transactions so a slow reader doesn't keep one open. The pending counts are flushed first so they're exported too.
+func Export(botBucket []byte, from, to time.Time, fn func(*Row) error) error {
+	Flush()
+
+	// the buckets to export, in order
+	sources := []counter{
+		{botBucket: string(botBucket)},
+		{botBucket: string(botBucket), hour: true},
+	}
+	err := db.DB.View(func(tx *bolt.Tx) error {
+		for _, hour := range []bool{false, true} {
+			each := buckets.EachCommandPerDay
+			if hour {
+				each = buckets.EachCommandPerHour
+			}
+			err := each(tx, botBucket, func(command []byte, bkt buckets.Bucket) error {
+				sources = append(sources, counter{botBucket: string(botBucket), command: string(command), hour: hour})
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("msg='error-exporting-stats', error='%v', botBucket='%s'\n", err, string(botBucket))
+		return err
+	}
+
+	for _, c := range sources {
+		if err := c.export(from, to, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// export calls fn with the counts of the counter's bucket between from and to, ExportBatch rows at a time
+func (c counter) export(from, to time.Time, fn func(*Row) error) error {
+	r := Row{Metric: MetricLines, Command: c.command, Period: PeriodDay}
+	if len(c.command) > 0 {
+		r.Metric = MetricCommands
+	}
+	if c.hour {
+		r.Period = PeriodHour
+	}
+
+	var start []byte
+	if !from.IsZero() {
+		start = []byte(from.In(time.Local).Format(time.RFC3339))
+	}
+
+	for {
+		batch := make([]*Row, 0, ExportBatch)
+		var next []byte
+		err := db.DB.View(func(tx *bolt.Tx) error {
+			bkt, err := c.bucket(tx)
+			if err == buckets.ErrBucketNotFound {
+				return nil
+			} else if err != nil {
+				return err
+			}
+
+			crs := bkt.Cursor()
+			k, v := crs.First()
+			if start != nil {
+				k, v = crs.Seek(start)
+			}
+			for ; k != nil; k, v = crs.Next() {
+				row := r
+
+				var err error
+				if row.Time, err = time.Parse(time.RFC3339, string(k)); err != nil {
+					log.Printf("msg='invalid-stats-key', key='%s', error='%v'\n", string(k), err)
+					continue
+				}
+				if (!from.IsZero() && row.Time.Before(from)) || (!to.IsZero() && row.Time.After(to)) {
+					continue
+				}
+				if len(batch) == ExportBatch {
+					next = append([]byte{}, k...)
+					return nil
+				}
+				if row.Count, err = strconv.ParseInt(string(v), 10, 64); err != nil {
+					log.Printf("msg='invalid-stats-count', key='%s', error='%v'\n", string(k), err)
+					continue
+				}
+				batch = append(batch, &row)
+			}
+			return nil
+		})
+		if err != nil {
+			log.Printf("msg='error-exporting-stats', error='%v', botBucket='%s'\n", err, c.botBucket)
+			return err
+		}
+
+		for _, row := range batch {
+			if err := fn(row); err != nil {
+				return err
+			}
+		}
+		if next == nil {
+			return nil
+		}
+		start = next
+	}
+}
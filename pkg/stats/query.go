@@ -0,0 +1,286 @@
+package stats
+
+import (
+	"errors"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/StreamMeBots/meep/pkg/buckets"
+	"github.com/StreamMeBots/meep/pkg/db"
+
+	"github.com/boltdb/bolt"
+	"github.com/jinzhu/now"
+)
+
+// Errors
+var (
+	ErrInvalidGranularity = errors.New("granularity should be hour, day, week or month")
+	ErrInvalidRange       = errors.New("from should be before to")
+	ErrTooManyPoints      = errors.New("range has too many points for the granularity")
+)
+
+// granularities, hours are read from the per hour buckets and the rest from the per day buckets
+const (
+	GranularityHour  = "hour"
+	GranularityDay   = "day"
+	GranularityWeek  = "week"
+	GranularityMonth = "month"
+)
+
+// MaxPoints is the most points a series can have
+var MaxPoints = 1000
+
+// Point is the count of a period
+type Point struct {
+	Time  time.Time `json:"time"` // the start of the period
+	Count int64     `json:"count"`
+}
+
+// Series is a metric's counts for each period of a range. Periods without any counts are 0.
+type Series struct {
+	Metric      string    `json:"metric"`
+	Command     string    `json:"command,omitempty"`
+	Granularity string    `json:"granularity"`
+	From        time.Time `json:"from"`
+	To          time.Time `json:"to"`
+	Total       int64     `json:"total"`
+	Points      []*Point  `json:"points"`
+}
+
+// CommandCount is the number of times a command was used
+type CommandCount struct {
+	Command string `json:"command"`
+	Count   int64  `json:"count"`
+}
+
+// DefaultRange is the range of a query without a from time
+func DefaultRange(granularity string, to time.Time) time.Time {
+	switch granularity {
+	case GranularityHour:
+		return to.Add(-48 * time.Hour)
+	case GranularityWeek:
+		return to.AddDate(0, 0, -7*12)
+	case GranularityMonth:
+		return to.AddDate(-1, 0, 0)
+	}
+	return to.AddDate(0, 0, -30)
+}
+
+// Lines gets the line counts between from and to
+func Lines(botBucket []byte, from, to time.Time, granularity string) (*Series, error) {
+	s, err := newSeries(MetricLines, "", from, to, granularity)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.read(botBucket)
+	if err != nil {
+		log.Printf("msg='error-querying-line-stats', error='%v', botBucket='%s'\n", err, string(botBucket))
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Commands gets a command's counts between from and to
+func Commands(botBucket []byte, name string, from, to time.Time, granularity string) (*Series, error) {
+	s, err := newSeries(MetricCommands, name, from, to, granularity)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.read(botBucket)
+	if err != nil {
+		log.Printf("msg='error-querying-command-stats', error='%v', botBucket='%s', command='%s'\n", err, string(botBucket), name)
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// TopCommands gets the n most used commands between from and to, a limit of 0 gets all of them. The per day counts
+// are used so the range is whole days.
+func TopCommands(botBucket []byte, from, to time.Time, n int) ([]*CommandCount, error) {
+	if to.Before(from) {
+		return nil, ErrInvalidRange
+	}
+	from = truncate(from, GranularityDay)
+
+	totals := map[string]int64{}
+
+	flushMu.RLock()
+	err := db.DB.View(func(tx *bolt.Tx) error {
+		return buckets.EachCommandPerDay(tx, botBucket, func(command []byte, bkt buckets.Bucket) error {
+			sumRange(bkt, from, to, func(t time.Time, count int64) {
+				totals[string(command)] += count
+			})
+			return nil
+		})
+	})
+	if err == nil {
+		eachPending(botBucket, func(c counter, count int64) {
+			if len(c.command) == 0 || c.hour {
+				return
+			}
+			if t, err := time.Parse(time.RFC3339, c.period); err == nil && !t.Before(from) && !t.After(to) {
+				totals[c.command] += count
+			}
+		})
+	}
+	flushMu.RUnlock()
+	if err != nil {
+		log.Printf("msg='error-querying-top-commands', error='%v', botBucket='%s'\n", err, string(botBucket))
+		return nil, err
+	}
+
+	counts := []*CommandCount{}
+	for command, count := range totals {
+		if count > 0 {
+			counts = append(counts, &CommandCount{Command: command, Count: count})
+		}
+	}
+
+	sort.Sort(byCount(counts))
+	if n > 0 && len(counts) > n {
+		counts = counts[:n]
+	}
+	return counts, nil
+}
+
+type byCount []*CommandCount
+
+func (c byCount) Len() int      { return len(c) }
+func (c byCount) Swap(i, j int) { c[i], c[j] = c[j], c[i] }
+func (c byCount) Less(i, j int) bool {
+	if c[i].Count == c[j].Count {
+		return c[i].Command < c[j].Command
+	}
+	return c[i].Count > c[j].Count
+}
+
+// newSeries creates a series with a zero point for every period between from and to
+func newSeries(metric, command string, from, to time.Time, granularity string) (*Series, error) {
+	switch granularity {
+	case GranularityHour, GranularityDay, GranularityWeek, GranularityMonth:
+	default:
+		return nil, ErrInvalidGranularity
+	}
+	if to.Before(from) {
+		return nil, ErrInvalidRange
+	}
+
+	s := &Series{
+		Metric:      metric,
+		Command:     command,
+		Granularity: granularity,
+		From:        truncate(from, granularity),
+		To:          to,
+		Points:      []*Point{},
+	}
+	for t := s.From; !t.After(to); t = next(t, granularity) {
+		if len(s.Points) == MaxPoints {
+			return nil, ErrTooManyPoints
+		}
+		s.Points = append(s.Points, &Point{Time: t})
+	}
+	return s, nil
+}
+
+// read adds the bot's counts, flushed or not, to the series' points
+func (s *Series) read(botBucket []byte) error {
+	// points are found by the start of their period
+	points := make(map[int64]*Point, len(s.Points))
+	for _, p := range s.Points {
+		points[p.Time.Unix()] = p
+	}
+	add := func(t time.Time, count int64) {
+		if t.Before(s.From) || t.After(s.To) {
+			return
+		}
+		if p, ok := points[truncate(t, s.Granularity).Unix()]; ok {
+			p.Count += count
+			s.Total += count
+		}
+	}
+
+	// hours are read from the per hour counts and the rest from the per day counts
+	c := counter{botBucket: string(botBucket), command: s.Command, hour: s.Granularity == GranularityHour}
+
+	flushMu.RLock()
+	defer flushMu.RUnlock()
+
+	err := db.DB.View(func(tx *bolt.Tx) error {
+		bkt, err := c.bucket(tx)
+		if err == buckets.ErrBucketNotFound {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		sumRange(bkt, s.From, s.To, add)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	eachPending(botBucket, func(p counter, count int64) {
+		if p.command != c.command || p.hour != c.hour {
+			return
+		}
+		if t, err := time.Parse(time.RFC3339, p.period); err == nil {
+			add(t, count)
+		}
+	})
+	return nil
+}
+
+// sumRange calls fn with each count between from and to. The keys are RFC3339 times so the cursor seeks to from and
+// stops after to.
+func sumRange(bkt buckets.Bucket, from, to time.Time, fn func(t time.Time, count int64)) {
+	crs := bkt.Cursor()
+	for k, v := crs.Seek([]byte(from.In(time.Local).Format(time.RFC3339))); k != nil; k, v = crs.Next() {
+		t, err := time.Parse(time.RFC3339, string(k))
+		if err != nil {
+			continue
+		}
+		if t.After(to) {
+			return
+		}
+
+		count, err := strconv.ParseInt(string(v), 10, 64)
+		if err != nil {
+			continue
+		}
+		fn(t, count)
+	}
+}
+
+// truncate gets the start of the period t is in. Stats are written in the server's timezone so periods are too.
+func truncate(t time.Time, granularity string) time.Time {
+	n := now.New(t.In(time.Local))
+	switch granularity {
+	case GranularityHour:
+		return n.BeginningOfHour()
+	case GranularityWeek:
+		return n.BeginningOfWeek()
+	case GranularityMonth:
+		return n.BeginningOfMonth()
+	}
+	return n.BeginningOfDay()
+}
+
+// next gets the start of the period after t
+func next(t time.Time, granularity string) time.Time {
+	switch granularity {
+	case GranularityHour:
+		return t.Add(time.Hour)
+	case GranularityWeek:
+		return t.AddDate(0, 0, 7)
+	case GranularityMonth:
+		return t.AddDate(0, 1, 0)
+	}
+	return t.AddDate(0, 0, 1)
+}
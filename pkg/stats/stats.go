@@ -5,8 +5,8 @@
 package stats
 
 import (
-	"fmt"
 	"log"
+	"sync"
 	"time"
 
 	"github.com/StreamMeBots/meep/pkg/buckets"
@@ -17,124 +17,140 @@ import (
 	"github.com/jinzhu/now"
 )
 
-// CommandThrottle number of lines between a command can be displayed
-var CommandThrottle int64 = 10
-
 // Line keep track of line stats
 func x(tx *bolt.Tx, publicId []byte) error {
 	return nil
 }
 
-// Line write line stats, aky SAY commands
+// FlushInterval is how often the counts are written to the db
+var FlushInterval = time.Second * 10
+
+// counter is a count of a stats bucket's period that hasn't been written yet
+type counter struct {
+	botBucket string
+	command   string // empty for lines
+	hour      bool   // per hour, otherwise per day
+	period    string // the RFC3339 key of the period
+}
+
+var (
+	// mu guards pending
+	mu      sync.Mutex
+	pending = map[counter]int64{}
+
+	// flushMu is held by flushes while they write and by queries while they read, so a query sees each count in
+	// either pending or the db
+	flushMu sync.RWMutex
+
+	stop = make(chan struct{})
+	done = make(chan struct{})
+)
+
+// Line counts a line, aka SAY commands
 func Line(userPublicId []byte) {
-	db.DB.Update(func(tx *bolt.Tx) error {
-		day := []byte(now.BeginningOfDay().Format(time.RFC3339))
-		bkt, err := buckets.LinesPerDay(tx, userPublicId)
-		if err != nil {
-			return fmt.Errorf("msg='error-getting-lines-per-day-bucket', error='%v', userPublicId='%v'\n", err, userPublicId)
-		}
-		if _, err := buckets.Incr(bkt.Bucket, day); err != nil {
-			return err
-		}
-		return nil
-	})
+	incr(userPublicId, "")
+}
 
-	db.DB.Update(func(tx *bolt.Tx) error {
-		hour := []byte(now.BeginningOfHour().Format(time.RFC3339))
-		bkt, err := buckets.LinesPerHour(tx, userPublicId)
-		if err != nil {
-			return fmt.Errorf("msg='error-getting-lines-per-hour-bucket', error='%v', userPublicId='%v'\n", err, userPublicId)
-		}
-		if _, err := buckets.Incr(bkt.Bucket, hour); err != nil {
-			return err
-		}
-		return nil
-	})
+// Command counts a command. Commands should be checked against their cooldowns before they are said.
+func Command(userPublicId []byte, cmd *command.Command) {
+	incr(userPublicId, cmd.Name)
+}
 
-	cmds, err := command.GetAll(userPublicId)
-	if err != nil {
-		log.Printf("msg='error-getting-commands', error='%v' userPublicId='%s'\n", err, userPublicId)
-		return
-	}
+// incr adds one to the current hour and day of a line or command
+func incr(botBucket []byte, command string) {
+	day := now.BeginningOfDay().Format(time.RFC3339)
+	hour := now.BeginningOfHour().Format(time.RFC3339)
 
-	cmds = append(cmds, &command.Command{
-		Name: "answeringMachine", // this is a bit of a hack...
-	})
-	for _, cmd := range cmds {
-		// tmp code till frontend adds throttle option
-		if cmd.Throttle == 0 {
-			cmd.Throttle = 2
-		}
+	mu.Lock()
+	pending[counter{botBucket: string(botBucket), command: command, period: day}]++
+	pending[counter{botBucket: string(botBucket), command: command, hour: true, period: hour}]++
+	mu.Unlock()
+}
+
+// Start flushes the counts every FlushInterval until Close is called
+func Start() {
+	defer close(done)
 
-		if cmd.Throttle == 0 {
-			continue
+	ticker := time.NewTicker(FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			Flush()
 		}
-		db.DB.Update(func(tx *bolt.Tx) error {
-			bkt, err := buckets.LastCommand(tx, userPublicId)
-			if err != nil {
-				return fmt.Errorf("msg='error-getting-last-commands-bucket', error='%v', userPublicId='%v'\n", err, userPublicId)
-			}
-			if _, err := buckets.Incr(bkt.Bucket, []byte(cmd.Name)); err != nil {
-				return err
-			}
-			return nil
-		})
 	}
 }
 
-// Command checks if a command should be written and writes command stats
-func Command(userPublicId []byte, cmd *command.Command) (ok bool) {
-	// tmp code till frontend adds throttle option
-	if cmd.Throttle == 0 {
-		cmd.Throttle = 2
+// Close stops Start and flushes the counts that are left, it should be called before the db is closed
+func Close() {
+	close(stop)
+	<-done
+	Flush()
+}
+
+// Flush writes the pending counts to the db in one batch. Counts that couldn't be written are kept for the next
+// flush.
+func Flush() {
+	flushMu.Lock()
+	defer flushMu.Unlock()
+
+	mu.Lock()
+	counts := pending
+	pending = map[counter]int64{}
+	mu.Unlock()
+
+	if len(counts) == 0 {
+		return
 	}
 
-	if cmd.Throttle > 0 {
-		db.DB.Update(func(tx *bolt.Tx) error {
-			bkt, err := buckets.LastCommand(tx, userPublicId)
+	err := db.DB.Batch(func(tx *bolt.Tx) error {
+		for c, n := range counts {
+			bkt, err := c.bucket(tx)
 			if err != nil {
 				return err
 			}
-			c, err := buckets.GetInt64(bkt.Bucket, []byte(cmd.Name))
-			if err == buckets.ErrIntNotSet {
-				// edge case
-				c = cmd.Throttle + 1
-			} else if err != nil {
+			if _, err := buckets.IncrBy(bkt.Bucket, []byte(c.period), n); err != nil {
 				return err
 			}
-			if c > cmd.Throttle {
-				ok = true
-				// reset
-				return buckets.SetInt64(bkt.Bucket, []byte(cmd.Name), 0)
-			}
-			return nil
-		})
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("msg='error-flushing-stats', error='%v', counts='%d'\n", err, len(counts))
 
-		if !ok {
-			return false
+		mu.Lock()
+		for c, n := range counts {
+			pending[c] += n
 		}
+		mu.Unlock()
 	}
+}
 
-	db.DB.Update(func(tx *bolt.Tx) error {
-		day := []byte(now.BeginningOfDay().Format(time.RFC3339))
-		bkt, err := buckets.CommandsPerDay(tx, userPublicId, []byte(cmd.Name))
-		if err != nil {
-			log.Printf("msg='error-getting-commands-per-day-bucket', error='%v', userPublicId='%v', command='%s'\n", err, userPublicId, cmd.Name)
-			return err
-		}
-		_, err = buckets.Incr(bkt.Bucket, day)
-		return err
-	})
-	db.DB.Update(func(tx *bolt.Tx) error {
-		hour := []byte(now.BeginningOfHour().Format(time.RFC3339))
-		bkt, err := buckets.CommandsPerHour(tx, userPublicId, []byte(cmd.Name))
-		if err != nil {
-			log.Printf("msg='error-getting-commands-per-hour-bucket', error='%v', userPublicId='%v', command='%s'\n", err, userPublicId, cmd.Name)
-			return err
-		}
-		_, err = buckets.Incr(bkt.Bucket, hour)
-		return err
-	})
+// bucket gets the stats bucket of the counter
+func (c counter) bucket(tx *bolt.Tx) (buckets.Bucket, error) {
+	bot := []byte(c.botBucket)
+	switch {
+	case len(c.command) == 0 && c.hour:
+		return buckets.LinesPerHour(tx, bot)
+	case len(c.command) == 0:
+		return buckets.LinesPerDay(tx, bot)
+	case c.hour:
+		return buckets.CommandsPerHour(tx, bot, []byte(c.command))
+	}
+	return buckets.CommandsPerDay(tx, bot, []byte(c.command))
+}
 
-	return true
+// eachPending calls fn with the unflushed counts of a bot. Callers should hold flushMu.
+func eachPending(botBucket []byte, fn func(c counter, count int64)) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	for c, n := range pending {
+		if c.botBucket == string(botBucket) {
+			fn(c, n)
+		}
+	}
 }
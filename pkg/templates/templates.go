@@ -0,0 +1,337 @@
+/*
+* Package templates parses and executes the templates used by commands and greetings. The templates can use these
+* functions:
+*
+*	pick "a" "b" "c"           a random item
+*	weighted 3 "a" 1 "b"       a random item, each item follows its weight
+*	random 1 100               a random number between min and max, inclusive
+*	now                        the current time in the streamer's timezone
+*	since .LastVisit           how long ago a time was, e.g. "2 days, 3 hours"
+*	until "2016-12-25"         how long until a time
+*	formatTime "3:04 PM" now   a time formatted with a Go time layout in the streamer's timezone
+*	upper, lower               upper or lower case text
+*	truncate 20 .Rest          text cut to a number of characters
+*	plural 3 "death" "deaths"  the singular or plural word for a count
+*	greeting                   good morning, afternoon, evening or night in the streamer's timezone
+*	command "!uptime"          the output of another command, empty if it can't be used
+*	counter "deaths"           a counter's value
+*	incr "hugs"                adds one to a counter and returns the new value, e.g. the times a command was used
+*	var "game"                 a variable's value, empty if it's not set
+*
+* Times can be given as a time or a string in RFC3339 or 2006-01-02 format, dates are in the streamer's timezone.
+ */
+package templates
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// Options are used by the template functions when a template is executed
+type Options struct {
+	// Location is the streamer's timezone, UTC is used if it's nil
+	Location *time.Location
+
+	// Command gets another command's output for the command function
+	Command func(name string) (string, error)
+
+	// Variables are the bot's counters and variables
+	Variables Variables
+}
+
+// Variables gets and changes a bot's counters and variables
+type Variables interface {
+	Counter(name string) (int64, error)
+	Incr(name string, n int64) (int64, error)
+	Var(name string) (string, error)
+}
+
+func (o Options) location() *time.Location {
+	if o.Location == nil {
+		return time.UTC
+	}
+	return o.Location
+}
+
+// Funcs returns the template functions using the options
+func Funcs(o Options) template.FuncMap {
+	return funcs(&o)
+}
+
+// funcs returns the template functions, they use the options o points to when they're called
+func funcs(o *Options) template.FuncMap {
+	return template.FuncMap{
+		"pick":     pick,
+		"weighted": weighted,
+		"random":   random,
+		"now": func() time.Time {
+			return time.Now().In(o.location())
+		},
+		"since": func(t interface{}) (string, error) {
+			tm, err := toTime(t, o.location())
+			if err != nil {
+				return "", err
+			}
+			return Duration(time.Since(tm)), nil
+		},
+		"until": func(t interface{}) (string, error) {
+			tm, err := toTime(t, o.location())
+			if err != nil {
+				return "", err
+			}
+			return Duration(tm.Sub(time.Now())), nil
+		},
+		"formatTime": func(layout string, t interface{}) (string, error) {
+			tm, err := toTime(t, o.location())
+			if err != nil {
+				return "", err
+			}
+			return tm.In(o.location()).Format(layout), nil
+		},
+		"upper":    strings.ToUpper,
+		"lower":    strings.ToLower,
+		"truncate": truncate,
+		"plural":   plural,
+		"greeting": func() string {
+			return greeting(time.Now().In(o.location()))
+		},
+		"command": func(name string) string {
+			if o.Command == nil {
+				return ""
+			}
+			out, err := o.Command(name)
+			if err != nil {
+				return ""
+			}
+			return out
+		},
+		"counter": func(name string) int64 {
+			if o.Variables == nil {
+				return 0
+			}
+			v, _ := o.Variables.Counter(name)
+			return v
+		},
+		"incr": func(name string) int64 {
+			if o.Variables == nil {
+				return 0
+			}
+			v, err := o.Variables.Incr(name, 1)
+			if err != nil {
+				log.Printf("msg='error-incrementing-counter', name='%s', error='%v'\n", name, err)
+			}
+			return v
+		},
+		"var": func(name string) string {
+			if o.Variables == nil {
+				return ""
+			}
+			v, _ := o.Variables.Var(name)
+			return v
+		},
+	}
+}
+
+// Template is a parsed template. It can be cached and executed at the same time.
+type Template struct {
+	tmpl *template.Template
+	pool sync.Pool // *bound copies of tmpl that aren't being executed
+}
+
+// bound is a copy of a template whose functions were bound once to its options, they're set for each execution
+type bound struct {
+	tmpl *template.Template
+	o    Options
+}
+
+// Parse parses a template. Use it to validate templates.
+func Parse(text string) (*Template, error) {
+	t, err := template.New("msg").Funcs(Funcs(Options{})).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	return &Template{tmpl: t}, nil
+}
+
+// Execute parses and executes a template with the data
+func Execute(text string, data interface{}, o Options) (string, error) {
+	t, err := Parse(text)
+	if err != nil {
+		return "", err
+	}
+	return t.Execute(data, o)
+}
+
+// Execute executes the template with the data. A template is only copied when it's executed more times at once
+// than it has been before, e.g. by a command that uses its own output.
+func (t *Template) Execute(data interface{}, o Options) (string, error) {
+	b, ok := t.pool.Get().(*bound)
+	if !ok {
+		tmpl, err := t.tmpl.Clone()
+		if err != nil {
+			return "", err
+		}
+		b = &bound{tmpl: tmpl}
+		tmpl.Funcs(funcs(&b.o))
+	}
+
+	b.o = o
+	buf := &bytes.Buffer{}
+	err := b.tmpl.Execute(buf, data)
+	// don't keep the variables and commands of the execution around
+	b.o = Options{}
+	t.pool.Put(b)
+
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// Duration formats a duration with its two largest units, e.g. "2 days, 3 hours"
+func Duration(d time.Duration) string {
+	if d < 0 {
+		d = -d
+	}
+
+	units := []struct {
+		d    time.Duration
+		name string
+	}{
+		{time.Hour * 24 * 365, "year"},
+		{time.Hour * 24, "day"},
+		{time.Hour, "hour"},
+		{time.Minute, "minute"},
+		{time.Second, "second"},
+	}
+
+	parts := []string{}
+	for _, u := range units {
+		if d < u.d {
+			continue
+		}
+		n := int(d / u.d)
+		d -= time.Duration(n) * u.d
+		parts = append(parts, fmt.Sprintf("%d %s", n, plural(n, u.name, u.name+"s")))
+		if len(parts) == 2 {
+			break
+		}
+	}
+
+	if len(parts) == 0 {
+		return "0 seconds"
+	}
+	return strings.Join(parts, ", ")
+}
+
+func pick(items ...interface{}) interface{} {
+	if len(items) == 0 {
+		return ""
+	}
+	return items[rand.Intn(len(items))]
+}
+
+func weighted(args ...interface{}) (interface{}, error) {
+	if len(args) == 0 || len(args)%2 != 0 {
+		return nil, fmt.Errorf("weighted needs weight and item pairs")
+	}
+
+	weights := make([]int, len(args)/2)
+	total := 0
+	for i := range weights {
+		w, err := toInt(args[i*2])
+		if err != nil || w < 0 {
+			return nil, fmt.Errorf("weighted weights should be positive numbers")
+		}
+		weights[i] = w
+		total += w
+	}
+	if total == 0 {
+		return "", nil
+	}
+
+	n := rand.Intn(total)
+	for i, w := range weights {
+		if n < w {
+			return args[i*2+1], nil
+		}
+		n -= w
+	}
+	return args[len(args)-1], nil
+}
+
+func random(min, max interface{}) (int, error) {
+	lo, err := toInt(min)
+	if err != nil {
+		return 0, err
+	}
+	hi, err := toInt(max)
+	if err != nil {
+		return 0, err
+	}
+	if hi < lo {
+		lo, hi = hi, lo
+	}
+	return lo + rand.Intn(hi-lo+1), nil
+}
+
+func truncate(n int, s string) string {
+	r := []rune(s)
+	if n < 0 || len(r) <= n {
+		return s
+	}
+	return string(r[:n])
+}
+
+func plural(n interface{}, singular, plural string) string {
+	if c, err := toInt(n); err == nil && (c == 1 || c == -1) {
+		return singular
+	}
+	return plural
+}
+
+func greeting(t time.Time) string {
+	switch h := t.Hour(); {
+	case h >= 5 && h < 12:
+		return "Good morning"
+	case h >= 12 && h < 17:
+		return "Good afternoon"
+	case h >= 17 && h < 22:
+		return "Good evening"
+	}
+	return "Good night"
+}
+
+func toInt(v interface{}) (int, error) {
+	switch n := v.(type) {
+	case int:
+		return n, nil
+	case int64:
+		return int(n), nil
+	case float64:
+		return int(n), nil
+	case string:
+		return strconv.Atoi(n)
+	}
+	return 0, fmt.Errorf("%v is not a number", v)
+}
+
+func toTime(v interface{}, loc *time.Location) (time.Time, error) {
+	switch t := v.(type) {
+	case time.Time:
+		return t, nil
+	case string:
+		if tm, err := time.Parse(time.RFC3339, t); err == nil {
+			return tm, nil
+		}
+		return time.ParseInLocation("2006-01-02", t, loc)
+	}
+	return time.Time{}, fmt.Errorf("%v is not a time", v)
+}
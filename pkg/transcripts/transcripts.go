@@ -0,0 +1,376 @@
+/*
+* Package transcripts keeps a time ordered archive of a bot's chat. Entries are keyed by the time they were written
+* followed by a sequence number, so a bolt cursor walks them in order and a time can be found with Seek.
+ */
+package transcripts
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/StreamMeBots/meep/pkg/buckets"
+	"github.com/StreamMeBots/meep/pkg/db"
+
+	"github.com/boltdb/bolt"
+)
+
+// Errors
+var ErrInvalidCursor = errors.New("Invalid cursor")
+
+// entry types
+const (
+	TypeSay   = "say"
+	TypeJoin  = "join"
+	TypeLeave = "leave"
+	TypeBot   = "bot" // something the bot said
+)
+
+// DefaultLimit is the number of entries in a page when a query doesn't have a limit
+var DefaultLimit = 100
+
+// MaxLimit is the most entries in a page
+var MaxLimit = 500
+
+// MaxScan is the most entries a search reads for a page. A search for a user or text that few entries match can
+// return fewer entries than its limit and a Next cursor to keep searching from.
+var MaxScan = 10000
+
+// FlushInterval is how often the added entries are written to the db
+var FlushInterval = time.Second * 5
+
+// Entry is a line of a transcript
+type Entry struct {
+	Id           string    `json:"id"`
+	Time         time.Time `json:"time"`
+	Type         string    `json:"type"`
+	UserPublicId string    `json:"userPublicId,omitempty"`
+	Username     string    `json:"username,omitempty"`
+	Role         string    `json:"role,omitempty"`
+	Message      string    `json:"message,omitempty"`
+	MessageId    string    `json:"messageId,omitempty"`
+}
+
+// pendingEntry is an added entry that hasn't been written yet
+type pendingEntry struct {
+	botBucket string
+	entry     *Entry
+}
+
+var (
+	// mu guards pending
+	mu      sync.Mutex
+	pending = []pendingEntry{}
+
+	// flushMu is held by flushes while they write, so a flush returns once the entries added before it are written
+	flushMu sync.Mutex
+
+	stop = make(chan struct{})
+	done = make(chan struct{})
+)
+
+// Add appends an entry to the bot's transcript. The entry is written by the next flush.
+func Add(botBucket []byte, e *Entry) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	mu.Lock()
+	pending = append(pending, pendingEntry{botBucket: string(botBucket), entry: e})
+	mu.Unlock()
+}
+
+// Start flushes the added entries every FlushInterval until Close is called
+func Start() {
+	defer close(done)
+
+	ticker := time.NewTicker(FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			Flush()
+		}
+	}
+}
+
+// Close stops Start and flushes the entries that are left, it should be called before the db is closed
+func Close() {
+	close(stop)
+	<-done
+	Flush()
+}
+
+// Flush writes the added entries to the db in one batch. Entries that couldn't be written are kept for the next
+// flush.
+func Flush() {
+	flushMu.Lock()
+	defer flushMu.Unlock()
+
+	mu.Lock()
+	entries := pending
+	pending = []pendingEntry{}
+	mu.Unlock()
+
+	if len(entries) == 0 {
+		return
+	}
+
+	err := db.DB.Batch(func(tx *bolt.Tx) error {
+		for _, p := range entries {
+			bkt, err := buckets.Transcripts(tx, []byte(p.botBucket))
+			if err != nil {
+				return err
+			}
+
+			seq, err := bkt.NextSequence()
+			if err != nil {
+				return err
+			}
+			k := key(p.entry.Time, seq)
+			p.entry.Id = hex.EncodeToString(k)
+
+			b, err := json.Marshal(p.entry)
+			if err != nil {
+				return err
+			}
+			if err := bkt.Put(k, b); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("msg='error-flushing-transcripts', error='%v', entries='%d'\n", err, len(entries))
+
+		mu.Lock()
+		pending = append(entries, pending...)
+		mu.Unlock()
+	}
+}
+
+// Query filters a transcript. The zero Query gets the newest entries.
+type Query struct {
+	From   time.Time
+	To     time.Time
+	User   string // username or public id
+	Text   string // text the message contains, case is ignored
+	Cursor string // Next of the previous page
+	Limit  int
+}
+
+// Page is a page of entries, newest first. Next is the cursor of the following page and is empty on the last page.
+type Page struct {
+	Entries []*Entry `json:"entries"`
+	Next    string   `json:"next,omitempty"`
+}
+
+// match reports if the entry matches the query's user and text
+func (q *Query) match(e *Entry) bool {
+	if len(q.User) > 0 && e.UserPublicId != q.User && !strings.EqualFold(e.Username, strings.TrimPrefix(q.User, "@")) {
+		return false
+	}
+	if len(q.Text) > 0 && !strings.Contains(strings.ToLower(e.Message), strings.ToLower(q.Text)) {
+		return false
+	}
+	return true
+}
+
+// Search gets a page of a bot's transcript, newest first. At most MaxScan entries are read for a page.
+func Search(botBucket []byte, q Query) (*Page, error) {
+	if q.Limit <= 0 {
+		q.Limit = DefaultLimit
+	}
+	if q.Limit > MaxLimit {
+		q.Limit = MaxLimit
+	}
+
+	var start []byte
+	if len(q.Cursor) > 0 {
+		var err error
+		if start, err = hex.DecodeString(q.Cursor); err != nil || len(start) != 16 {
+			return nil, ErrInvalidCursor
+		}
+	} else if !q.To.IsZero() {
+		// the first key after To
+		start = key(q.To.Add(time.Nanosecond), 0)
+	}
+
+	// entries that were just added are searched too
+	Flush()
+
+	p := &Page{Entries: []*Entry{}}
+	err := db.DB.View(func(tx *bolt.Tx) error {
+		bkt, err := buckets.Transcripts(tx, botBucket)
+		if err == buckets.ErrBucketNotFound {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		crs := bkt.Cursor()
+		var k, v []byte
+		if start == nil {
+			k, v = crs.Last()
+		} else if k, v = crs.Seek(start); k == nil {
+			k, v = crs.Last()
+		} else {
+			k, v = crs.Prev()
+		}
+
+		// last is the key of the entry read before k, the next page starts after it
+		var last []byte
+		for scanned := 0; k != nil; k, v = crs.Prev() {
+			if !q.From.IsZero() && keyTime(k).Before(q.From) {
+				return nil
+			}
+			if len(p.Entries) == q.Limit || scanned == MaxScan {
+				p.Next = hex.EncodeToString(last)
+				return nil
+			}
+			last = k
+			scanned++
+
+			e := &Entry{}
+			if err := json.Unmarshal(v, &e); err != nil {
+				log.Printf("msg='json-unmarshal-error', error='%v'\n", err)
+				continue
+			}
+			if q.match(e) {
+				p.Entries = append(p.Entries, e)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("msg='error-searching-transcript', error='%v', botBucket='%s'\n", err, string(botBucket))
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// ExportBatch is the number of entries read in each transaction of an export
+var ExportBatch = 1000
+
+// CSVHeader are the columns of exported CSV files
+var CSVHeader = []string{"id", "time", "type", "userPublicId", "username", "role", "message", "messageId"}
+
+// CSV is the entry's CSVHeader columns
+func (e *Entry) CSV() []string {
+	return []string{e.Id, e.Time.Format(time.RFC3339Nano), e.Type, e.UserPublicId, e.Username, e.Role, e.Message, e.MessageId}
+}
+
+// Export calls fn with each entry between from and to, oldest first, a zero time isn't checked. The entries are read
+// in batches of ExportBatch so the transcript is never all in memory and fn isn't called in a transaction.
+func Export(botBucket []byte, from, to time.Time, fn func(*Entry) error) error {
+	Flush()
+
+	var start []byte
+	if !from.IsZero() {
+		start = key(from, 0)
+	}
+
+	for {
+		batch := make([]*Entry, 0, ExportBatch)
+		var next []byte
+		err := db.DB.View(func(tx *bolt.Tx) error {
+			bkt, err := buckets.Transcripts(tx, botBucket)
+			if err == buckets.ErrBucketNotFound {
+				return nil
+			} else if err != nil {
+				return err
+			}
+
+			crs := bkt.Cursor()
+			k, v := crs.First()
+			if start != nil {
+				k, v = crs.Seek(start)
+			}
+			for ; k != nil; k, v = crs.Next() {
+				if !to.IsZero() && keyTime(k).After(to) {
+					return nil
+				}
+				if len(batch) == ExportBatch {
+					next = append([]byte{}, k...)
+					return nil
+				}
+
+				e := &Entry{}
+				if err := json.Unmarshal(v, &e); err != nil {
+					log.Printf("msg='json-unmarshal-error', error='%v'\n", err)
+					continue
+				}
+				batch = append(batch, e)
+			}
+			return nil
+		})
+		if err != nil {
+			log.Printf("msg='error-exporting-transcript', error='%v', botBucket='%s'\n", err, string(botBucket))
+			return err
+		}
+
+		for _, e := range batch {
+			if err := fn(e); err != nil {
+				return err
+			}
+		}
+		if next == nil {
+			return nil
+		}
+		start = next
+	}
+}
+
+// Prune deletes the entries older than before. The number of entries deleted is returned.
+func Prune(botBucket []byte, before time.Time) (int, error) {
+	end := key(before, 0)
+	n := 0
+	err := db.DB.Update(func(tx *bolt.Tx) error {
+		bkt, err := buckets.Transcripts(tx, botBucket)
+		if err != nil {
+			return err
+		}
+
+		// keys are collected first, deleting while walking a cursor skips entries
+		old := [][]byte{}
+		crs := bkt.Cursor()
+		for k, _ := crs.First(); k != nil && bytes.Compare(k, end) < 0; k, _ = crs.Next() {
+			old = append(old, append([]byte{}, k...))
+		}
+		for _, k := range old {
+			if err := bkt.Delete(k); err != nil {
+				return err
+			}
+		}
+		n = len(old)
+		return nil
+	})
+	if err != nil {
+		log.Printf("msg='error-pruning-transcript', error='%v', botBucket='%s'\n", err, string(botBucket))
+		return 0, err
+	}
+
+	return n, nil
+}
+
+// key is the time followed by the sequence number
+func key(t time.Time, seq uint64) []byte {
+	k := make([]byte, 16)
+	binary.BigEndian.PutUint64(k, uint64(t.UnixNano()))
+	binary.BigEndian.PutUint64(k[8:], seq)
+	return k
+}
+
+func keyTime(k []byte) time.Time {
+	return time.Unix(0, int64(binary.BigEndian.Uint64(k)))
+}
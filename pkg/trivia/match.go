@@ -0,0 +1,115 @@
+package trivia
+
+import (
+	"strings"
+	"unicode"
+)
+
+// articles are ignored at the start of answers, "The Beatles" matches "beatles"
+var articles = map[string]bool{"the": true, "a": true, "an": true}
+
+// Match reports if a guess is close enough to one of the question's answers. Case, punctuation and a leading article
+// are ignored and small typos are allowed in longer answers. Numbers have to be exact, "1968" isn't a typo of "1969".
+func Match(q *Question, guess string) bool {
+	g := normalize(guess)
+	if len(g) == 0 {
+		return false
+	}
+
+	for _, a := range q.Answers {
+		n := normalize(a)
+		if n == g {
+			return true
+		}
+		if digits(n) == digits(g) && distance(n, g) <= tolerance(n) {
+			return true
+		}
+	}
+	return false
+}
+
+// digits gets the digits of s in order, "1,000" and "1000" have the same digits
+func digits(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, s)
+}
+
+// tolerance is the number of typos allowed for an answer
+func tolerance(answer string) int {
+	switch l := len([]rune(answer)); {
+	case l <= 3:
+		return 0
+	case l <= 7:
+		return 1
+	}
+	return 2
+}
+
+// normalize lowercases s, turns punctuation into spaces and removes a leading article
+func normalize(s string) string {
+	words := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	if len(words) > 1 && articles[words[0]] {
+		words = words[1:]
+	}
+	return strings.Join(words, " ")
+}
+
+// distance is the Levenshtein distance between a and b
+func distance(a, b string) int {
+	ar, br := []rune(a), []rune(b)
+	prev := make([]int, len(br)+1)
+	cur := make([]int, len(br)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ar); i++ {
+		cur[0] = i
+		for j := 1; j <= len(br); j++ {
+			cost := 1
+			if ar[i-1] == br[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(br)]
+}
+
+func min(n ...int) int {
+	m := n[0]
+	for _, v := range n[1:] {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
+
+// Hint shows the first n letters of each word of the answer and hides the rest, e.g. "Pa___ Fr____"
+func Hint(answer string, n int) string {
+	hint := []rune{}
+	shown := 0
+	for _, r := range answer {
+		switch {
+		case unicode.IsSpace(r):
+			shown = 0
+			hint = append(hint, r)
+		case !unicode.IsLetter(r) && !unicode.IsNumber(r):
+			hint = append(hint, r)
+		case shown < n:
+			shown++
+			hint = append(hint, r)
+		default:
+			hint = append(hint, '_')
+		}
+	}
+	return string(hint)
+}
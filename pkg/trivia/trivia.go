@@ -0,0 +1,432 @@
+/*
+* Package trivia stores a bot's trivia question packs, settings and the viewers' scores. The game itself is run by
+* the bot, see Match and Hint for how answers are checked.
+ */
+package trivia
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/StreamMeBots/meep/pkg/buckets"
+	"github.com/StreamMeBots/meep/pkg/db"
+	"github.com/StreamMeBots/meep/pkg/points"
+
+	"github.com/boltdb/bolt"
+)
+
+// Errors
+var (
+	ErrPackNotFound = errors.New("Trivia pack not found")
+	ErrNoQuestions  = errors.New("There are no trivia questions")
+	ErrInvalidCSV   = errors.New("CSV should have a header row with question and answer columns")
+)
+
+// MaxQuestions is the most questions a pack can have
+var MaxQuestions = 1000
+
+// Settings are how a bot runs trivia
+type Settings struct {
+	Enabled    bool     `json:"enabled"`
+	Interval   int      `json:"interval"`   // minutes between questions asked on a timer, 0 only asks on !trivia
+	AnswerTime int      `json:"answerTime"` // seconds viewers have to answer
+	Hints      int      `json:"hints"`      // hints given while viewers answer
+	Reward     int64    `json:"reward"`     // points for a correct answer
+	Packs      []string `json:"packs"`      // packs questions are asked from, all of them if empty
+}
+
+// DefaultSettings are used until a bot's settings are saved
+var DefaultSettings = Settings{
+	AnswerTime: 60,
+	Hints:      2,
+	Reward:     10,
+}
+
+// Validate validates the Settings
+func (s *Settings) Validate() error {
+	if s.Interval < 0 || s.Interval > 1440 {
+		return fmt.Errorf("interval should be between 0 and 1440 minutes")
+	}
+	if s.AnswerTime < 10 || s.AnswerTime > 600 {
+		return fmt.Errorf("answerTime should be between 10 and 600 seconds")
+	}
+	if s.Hints < 0 || s.Hints > 5 {
+		return fmt.Errorf("hints should be between 0 and 5")
+	}
+	if s.Reward < 0 {
+		return fmt.Errorf("reward cannot be negative")
+	}
+	return nil
+}
+
+// HintEvery is how long to wait between hints
+func (s *Settings) HintEvery() time.Duration {
+	return time.Duration(s.AnswerTime) * time.Second / time.Duration(s.Hints+1)
+}
+
+// Save saves a bot's settings
+func (s *Settings) Save(botBucket []byte) error {
+	err := db.DB.Update(func(tx *bolt.Tx) error {
+		b, err := json.Marshal(s)
+		if err != nil {
+			return err
+		}
+		return buckets.TriviaSettings(tx).Put(botBucket, b)
+	})
+	if err != nil {
+		log.Printf("msg='error-saving-trivia-settings', error='%v', botBucket='%s'\n", err, string(botBucket))
+		return err
+	}
+
+	return nil
+}
+
+// GetSettings gets a bot's settings
+func GetSettings(botBucket []byte) (*Settings, error) {
+	s := DefaultSettings
+	err := db.DB.View(func(tx *bolt.Tx) error {
+		b := buckets.TriviaSettings(tx).Get(botBucket)
+		if b == nil {
+			return nil
+		}
+		return json.Unmarshal(b, &s)
+	})
+	if err != nil {
+		log.Printf("msg='error-getting-trivia-settings', error='%v', botBucket='%s'\n", err, string(botBucket))
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+// Question is a trivia question, any of the answers is correct
+type Question struct {
+	Question string   `json:"question"`
+	Answers  []string `json:"answers"`
+	Category string   `json:"category,omitempty"`
+}
+
+// Validate validates the Question
+func (q *Question) Validate() error {
+	if len(q.Question) == 0 || len(q.Question) > 300 {
+		return fmt.Errorf("question should be between 1 and 300 characters")
+	}
+	if len(q.Answers) == 0 || len(q.Answers) > 10 {
+		return fmt.Errorf("questions should have between 1 and 10 answers")
+	}
+	for _, a := range q.Answers {
+		if len(normalize(a)) == 0 || len(a) > 100 {
+			return fmt.Errorf("answers should be between 1 and 100 characters with at least one letter or number")
+		}
+	}
+	if len(q.Category) > 50 {
+		return fmt.Errorf("category cannot exceed 50 characters")
+	}
+	return nil
+}
+
+// Pack is a set of questions
+type Pack struct {
+	Name      string      `json:"name"`
+	Count     int         `json:"count"` // number of questions
+	Questions []*Question `json:"questions,omitempty"`
+	Updated   time.Time   `json:"updated"`
+}
+
+// Validate validates the Pack
+func (p *Pack) Validate() error {
+	if len(p.Name) == 0 || len(p.Name) > 50 {
+		return fmt.Errorf("Pack name should be between 1 and 50 characters")
+	}
+	if len(p.Questions) == 0 || len(p.Questions) > MaxQuestions {
+		return fmt.Errorf("Packs should have between 1 and %d questions", MaxQuestions)
+	}
+	for i, q := range p.Questions {
+		if q == nil {
+			return fmt.Errorf("Question %d is empty", i+1)
+		}
+		if err := q.Validate(); err != nil {
+			return fmt.Errorf("Question %d: %v", i+1, err)
+		}
+	}
+	return nil
+}
+
+// Save saves the pack, a pack with the same name is replaced
+func (p *Pack) Save(botBucket []byte) error {
+	p.Count = len(p.Questions)
+	p.Updated = time.Now()
+
+	err := db.DB.Update(func(tx *bolt.Tx) error {
+		bkt, err := buckets.TriviaPacks(tx, botBucket)
+		if err != nil {
+			return err
+		}
+
+		b, err := json.Marshal(p)
+		if err != nil {
+			return err
+		}
+		return bkt.Put([]byte(p.Name), b)
+	})
+	if err != nil {
+		log.Printf("msg='error-saving-trivia-pack', error='%v', botBucket='%s', pack='%s'\n", err, string(botBucket), p.Name)
+		return err
+	}
+
+	return nil
+}
+
+// GetPack gets a pack with its questions
+func GetPack(botBucket []byte, name string) (*Pack, error) {
+	var p *Pack
+	err := view(buckets.TriviaPacks, botBucket, func(bkt buckets.Bucket) error {
+		b := bkt.Get([]byte(name))
+		if b == nil {
+			return nil
+		}
+		return json.Unmarshal(b, &p)
+	})
+	if err != nil {
+		log.Printf("msg='error-getting-trivia-pack', error='%v', botBucket='%s', pack='%s'\n", err, string(botBucket), name)
+		return nil, err
+	}
+
+	if p == nil {
+		return nil, ErrPackNotFound
+	}
+	return p, nil
+}
+
+// GetPacks gets a bot's packs without their questions
+func GetPacks(botBucket []byte) ([]*Pack, error) {
+	ps := []*Pack{}
+	err := view(buckets.TriviaPacks, botBucket, func(bkt buckets.Bucket) error {
+		return bkt.ForEach(func(k, v []byte) error {
+			p := &Pack{}
+			if err := json.Unmarshal(v, &p); err != nil {
+				log.Printf("msg='json-unmarshal-error', key='%s', error='%v'\n", string(k), err)
+				return nil
+			}
+			p.Questions = nil
+			ps = append(ps, p)
+			return nil
+		})
+	})
+	if err != nil {
+		log.Printf("msg='error-getting-trivia-packs', error='%v', botBucket='%s'\n", err, string(botBucket))
+		return nil, err
+	}
+
+	return ps, nil
+}
+
+// DeletePack deletes a pack
+func DeletePack(botBucket []byte, name string) error {
+	err := db.DB.Update(func(tx *bolt.Tx) error {
+		bkt, err := buckets.TriviaPacks(tx, botBucket)
+		if err != nil {
+			return err
+		}
+
+		if bkt.Get([]byte(name)) == nil {
+			return ErrPackNotFound
+		}
+		return bkt.Delete([]byte(name))
+	})
+	if err != nil && err != ErrPackNotFound {
+		log.Printf("msg='error-deleting-trivia-pack', error='%v', botBucket='%s', pack='%s'\n", err, string(botBucket), name)
+	}
+
+	return err
+}
+
+// Random picks a question from the packs, or from all of the bot's packs if packs is empty. The question last asked
+// is skipped if there are others to pick from.
+func Random(botBucket []byte, packs []string, last string) (*Question, error) {
+	use := map[string]bool{}
+	for _, p := range packs {
+		use[p] = true
+	}
+
+	qs := []*Question{}
+	err := view(buckets.TriviaPacks, botBucket, func(bkt buckets.Bucket) error {
+		return bkt.ForEach(func(k, v []byte) error {
+			if len(use) > 0 && !use[string(k)] {
+				return nil
+			}
+
+			p := &Pack{}
+			if err := json.Unmarshal(v, &p); err != nil {
+				log.Printf("msg='json-unmarshal-error', key='%s', error='%v'\n", string(k), err)
+				return nil
+			}
+			for _, q := range p.Questions {
+				if q.Question != last {
+					qs = append(qs, q)
+				}
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		log.Printf("msg='error-getting-trivia-question', error='%v', botBucket='%s'\n", err, string(botBucket))
+		return nil, err
+	}
+
+	if len(qs) == 0 {
+		return nil, ErrNoQuestions
+	}
+	return qs[rand.Intn(len(qs))], nil
+}
+
+// ReadCSV reads questions from CSV. The first row is a header naming the columns, the question and answer columns
+// are required. Answers are separated by '|'.
+func ReadCSV(r io.Reader) ([]*Question, error) {
+	rows, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, ErrInvalidCSV
+	}
+
+	cols := map[string]int{}
+	for i, name := range rows[0] {
+		cols[strings.TrimSpace(name)] = i
+	}
+	_, q := cols["question"]
+	_, a := cols["answer"]
+	if !q || !a {
+		return nil, ErrInvalidCSV
+	}
+
+	get := func(row []string, name string) string {
+		i, ok := cols[name]
+		if !ok || i >= len(row) {
+			return ""
+		}
+		return strings.TrimSpace(row[i])
+	}
+
+	qs := []*Question{}
+	for _, row := range rows[1:] {
+		q := &Question{
+			Question: get(row, "question"),
+			Answers:  []string{},
+			Category: get(row, "category"),
+		}
+		for _, a := range strings.Split(get(row, "answer"), "|") {
+			if a = strings.TrimSpace(a); len(a) > 0 {
+				q.Answers = append(q.Answers, a)
+			}
+		}
+		qs = append(qs, q)
+	}
+
+	return qs, nil
+}
+
+// Score is a viewer's trivia score
+type Score struct {
+	UserPublicId string `json:"userPublicId"`
+	Username     string `json:"username"`
+	Correct      int    `json:"correct"`
+}
+
+// Win adds a correct answer to the viewer's score and gives them the reward points in the same transaction
+func Win(botBucket []byte, userPublicId, username string, reward int64) (*Score, error) {
+	s := &Score{UserPublicId: userPublicId}
+	err := db.DB.Update(func(tx *bolt.Tx) error {
+		bkt, err := buckets.TriviaScores(tx, botBucket)
+		if err != nil {
+			return err
+		}
+
+		if b := bkt.Get([]byte(userPublicId)); b != nil {
+			if err := json.Unmarshal(b, &s); err != nil {
+				return err
+			}
+		}
+		s.Username = username
+		s.Correct++
+
+		b, err := json.Marshal(s)
+		if err != nil {
+			return err
+		}
+		if err := bkt.Put([]byte(userPublicId), b); err != nil {
+			return err
+		}
+
+		if reward <= 0 {
+			return nil
+		}
+		_, err = points.ApplyTx(tx, botBucket, points.Change{
+			UserPublicId: userPublicId,
+			Username:     username,
+			Amount:       reward,
+			Reason:       points.ReasonTrivia,
+		}, false)
+		return err
+	})
+	if err != nil {
+		log.Printf("msg='error-saving-trivia-score', error='%v', botBucket='%s'\n", err, string(botBucket))
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// GetScores gets the scores from highest to lowest, a limit of 0 gets all of them
+func GetScores(botBucket []byte, limit int) ([]*Score, error) {
+	scores := []*Score{}
+	err := view(buckets.TriviaScores, botBucket, func(bkt buckets.Bucket) error {
+		return bkt.ForEach(func(k, v []byte) error {
+			s := &Score{}
+			if err := json.Unmarshal(v, &s); err != nil {
+				log.Printf("msg='json-unmarshal-error', key='%s', error='%v'\n", string(k), err)
+				return nil
+			}
+			scores = append(scores, s)
+			return nil
+		})
+	})
+	if err != nil {
+		log.Printf("msg='error-getting-trivia-scores', error='%v', botBucket='%s'\n", err, string(botBucket))
+		return nil, err
+	}
+
+	sort.Sort(byCorrect(scores))
+	if limit > 0 && len(scores) > limit {
+		scores = scores[:limit]
+	}
+	return scores, nil
+}
+
+type byCorrect []*Score
+
+func (s byCorrect) Len() int           { return len(s) }
+func (s byCorrect) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byCorrect) Less(i, j int) bool { return s[i].Correct > s[j].Correct }
+
+// view is a helper for reading one of a bot's trivia buckets, fn is not called if the bucket doesn't exist yet
+func view(bucket func(*bolt.Tx, []byte) (buckets.Bucket, error), botBucket []byte, fn func(bkt buckets.Bucket) error) error {
+	return db.DB.View(func(tx *bolt.Tx) error {
+		bkt, err := bucket(tx, botBucket)
+		if err == buckets.ErrBucketNotFound {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		return fn(bkt)
+	})
+}
@@ -0,0 +1,84 @@
+package user
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/StreamMeBots/meep/pkg/buckets"
+	"github.com/StreamMeBots/meep/pkg/db"
+
+	"github.com/boltdb/bolt"
+)
+
+// Settings are a user's bot settings
+type Settings struct {
+	Timezone       string `json:"timezone"`       // IANA timezone name, e.g. America/Denver. Empty means UTC.
+	TranscriptDays int    `json:"transcriptDays"` // days chat transcripts are kept, 0 keeps them forever
+}
+
+// Validate validates the Settings
+func (s *Settings) Validate() error {
+	if _, err := time.LoadLocation(s.Timezone); err != nil {
+		return fmt.Errorf("timezone is not a known timezone")
+	}
+	if s.TranscriptDays < 0 || s.TranscriptDays > 3650 {
+		return fmt.Errorf("transcriptDays should be between 0 and 3650")
+	}
+	return nil
+}
+
+// Location returns the settings' timezone
+func (s *Settings) Location() *time.Location {
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// Save saves a user's settings
+func (s *Settings) Save(userBucket []byte) error {
+	err := db.DB.Update(func(tx *bolt.Tx) error {
+		b, err := json.Marshal(s)
+		if err != nil {
+			return err
+		}
+
+		return buckets.UserSettings(tx).Put(userBucket, b)
+	})
+	if err != nil {
+		log.Printf("msg='error-saving-user-settings' error='%v' userBucket='%s'\n", err, string(userBucket))
+		return err
+	}
+
+	return nil
+}
+
+// GetSettings gets a user's settings
+func GetSettings(userBucket []byte) (*Settings, error) {
+	s := &Settings{}
+	err := db.DB.View(func(tx *bolt.Tx) error {
+		b := buckets.UserSettings(tx).Get(userBucket)
+		if b == nil {
+			return nil
+		}
+		return json.Unmarshal(b, &s)
+	})
+	if err != nil {
+		log.Printf("msg='error-getting-user-settings' error='%v' userBucket='%s'\n", err, string(userBucket))
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Location gets a user's timezone, UTC is returned if it can't be read
+func Location(userBucket []byte) *time.Location {
+	s, err := GetSettings(userBucket)
+	if err != nil {
+		return time.UTC
+	}
+	return s.Location()
+}
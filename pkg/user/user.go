@@ -1,14 +1,10 @@
 package user
 
 import (
-	"crypto/sha1"
 	"encoding/json"
 	"errors"
-	"fmt"
 	"log"
 	"net/http"
-	"strconv"
-	"time"
 
 	"github.com/StreamMeBots/meep/pkg/buckets"
 	"github.com/StreamMeBots/meep/pkg/config"
@@ -65,7 +61,6 @@ type User struct {
 	PublicId   string `json:"publicId"`
 	Email      string `json:"email"`
 	ChatRoomId string `json:"chatRoomId"`
-	SessId     string `json:"sessId"`
 	Links      Links  `json:"_links"`
 }
 
@@ -90,6 +85,28 @@ func (u *User) Save() error {
 	return nil
 }
 
+// Get gets a saved user
+func Get(userPublicId string) (*User, error) {
+	var u *User
+	err := db.DB.View(func(tx *bolt.Tx) error {
+		b := buckets.UserData(tx).Get([]byte(userPublicId))
+		if b == nil {
+			return nil
+		}
+		return json.Unmarshal(b, &u)
+	})
+	if err != nil {
+		log.Printf("msg='error-getting-user' error='%v' userPublicId='%s'\n", err, userPublicId)
+		return nil, err
+	}
+
+	if u == nil {
+		return nil, ErrNotFound
+	}
+
+	return u, nil
+}
+
 // Get gets a user from stream.me using a pre-authorized http client
 func GetByClient(client *http.Client, userIp string) (*User, error) {
 
@@ -115,8 +132,5 @@ func GetByClient(client *http.Client, userIp string) (*User, error) {
 	// hack until the api provies the user's chat room
 	u.ChatRoomId = "user:" + u.PublicId + ":web"
 
-	// create a session ID
-	u.SessId = fmt.Sprintf("%x", sha1.Sum([]byte(u.PublicId+strconv.FormatInt(time.Now().UnixNano(), 10))))
-
 	return u, nil
 }
@@ -0,0 +1,66 @@
+package variables
+
+// Store gives templates access to a bot's counters and variables
+type Store []byte
+
+// Counter gets a counter's value
+func (s Store) Counter(name string) (int64, error) {
+	return GetCounter(s, name)
+}
+
+// Incr adds n to a counter
+func (s Store) Incr(name string, n int64) (int64, error) {
+	return Incr(s, name, n)
+}
+
+// Var gets a variable's value
+func (s Store) Var(name string) (string, error) {
+	return GetVar(s, name)
+}
+
+// Snapshot is a read only copy of a bot's counters and variables. Use it for templates that are executed inside a
+// bolt transaction.
+type Snapshot struct {
+	counters map[string]int64
+	vars     map[string]string
+}
+
+// NewSnapshot copies a bot's counters and variables
+func NewSnapshot(botBucket []byte) *Snapshot {
+	s := &Snapshot{
+		counters: map[string]int64{},
+		vars:     map[string]string{},
+	}
+
+	if counters, err := GetAllCounters(botBucket); err == nil {
+		for _, c := range counters {
+			s.counters[c.Name] = c.Value
+		}
+	}
+	if vars, err := GetAllVars(botBucket); err == nil {
+		for _, v := range vars {
+			s.vars[v.Name] = v.Value
+		}
+	}
+
+	return s
+}
+
+// Counter gets a counter's value
+func (s *Snapshot) Counter(name string) (int64, error) {
+	return s.counters[Name(name)], nil
+}
+
+// Incr can't change a snapshot
+func (s *Snapshot) Incr(name string, n int64) (int64, error) {
+	return 0, ErrReadOnly
+}
+
+// Var gets a variable's value
+func (s *Snapshot) Var(name string) (string, error) {
+	v, ok := s.vars[Name(name)]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return v, nil
+}
@@ -0,0 +1,283 @@
+/*
+* Package variables stores a bot's named counters and string variables, e.g. a death counter or the current game
+ */
+package variables
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/StreamMeBots/meep/pkg/buckets"
+	"github.com/StreamMeBots/meep/pkg/db"
+
+	"github.com/boltdb/bolt"
+)
+
+// Errors
+var (
+	ErrNotFound = errors.New("Variable not found")
+	ErrReadOnly = errors.New("Variables can't be changed here")
+)
+
+// MaxValueLength is the longest a variable's value can be
+var MaxValueLength = 500
+
+// Counter is a named number
+type Counter struct {
+	Name  string `json:"name"`
+	Value int64  `json:"value"`
+}
+
+// Variable is a named string
+type Variable struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Name normalizes a counter or variable name, names are not case sensitive and a leading ! is ignored
+func Name(name string) string {
+	return strings.ToLower(strings.TrimPrefix(name, "!"))
+}
+
+// ValidateName validates a counter or variable name
+func ValidateName(name string) error {
+	if len(name) == 0 || len(name) > 50 || strings.ContainsAny(name, " \t") {
+		return fmt.Errorf("Name should be between 1 and 50 characters without spaces")
+	}
+	return nil
+}
+
+// Validate validates the Variable
+func (v *Variable) Validate() error {
+	if err := ValidateName(v.Name); err != nil {
+		return err
+	}
+	if len(v.Value) > MaxValueLength {
+		return fmt.Errorf("Variable value cannot exceed %d characters", MaxValueLength)
+	}
+	return nil
+}
+
+// GetCounter gets a counter's value. Counters that are not set are 0.
+func GetCounter(botBucket []byte, name string) (int64, error) {
+	var v int64
+	err := db.DB.View(func(tx *bolt.Tx) error {
+		bkt, err := buckets.Counters(tx, botBucket)
+		if err == buckets.ErrBucketNotFound {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		v, err = buckets.GetInt64(bkt.Bucket, []byte(Name(name)))
+		if err == buckets.ErrIntNotSet {
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		log.Printf("msg='error-getting-counter', error='%v', botBucket='%s', name='%s'\n", err, string(botBucket), name)
+		return 0, err
+	}
+
+	return v, nil
+}
+
+// HasCounter checks if a counter has been set
+func HasCounter(botBucket []byte, name string) (bool, error) {
+	var ok bool
+	err := db.DB.View(func(tx *bolt.Tx) error {
+		bkt, err := buckets.Counters(tx, botBucket)
+		if err == buckets.ErrBucketNotFound {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		ok = bkt.Get([]byte(Name(name))) != nil
+		return nil
+	})
+	if err != nil {
+		log.Printf("msg='error-getting-counter', error='%v', botBucket='%s', name='%s'\n", err, string(botBucket), name)
+		return false, err
+	}
+
+	return ok, nil
+}
+
+// Incr adds n to a counter and returns the new value
+func Incr(botBucket []byte, name string, n int64) (int64, error) {
+	name = Name(name)
+	if err := ValidateName(name); err != nil {
+		return 0, err
+	}
+
+	var v int64
+	err := db.DB.Update(func(tx *bolt.Tx) error {
+		bkt, err := buckets.Counters(tx, botBucket)
+		if err != nil {
+			return err
+		}
+
+		v, err = buckets.IncrBy(bkt.Bucket, []byte(name), n)
+		return err
+	})
+	if err != nil {
+		log.Printf("msg='error-incrementing-counter', error='%v', botBucket='%s', name='%s'\n", err, string(botBucket), name)
+		return 0, err
+	}
+
+	return v, nil
+}
+
+// SetCounter sets a counter's value
+func SetCounter(botBucket []byte, name string, v int64) error {
+	name = Name(name)
+	if err := ValidateName(name); err != nil {
+		return err
+	}
+
+	err := db.DB.Update(func(tx *bolt.Tx) error {
+		bkt, err := buckets.Counters(tx, botBucket)
+		if err != nil {
+			return err
+		}
+
+		return buckets.SetInt64(bkt.Bucket, []byte(name), v)
+	})
+	if err != nil {
+		log.Printf("msg='error-setting-counter', error='%v', botBucket='%s', name='%s'\n", err, string(botBucket), name)
+		return err
+	}
+
+	return nil
+}
+
+// GetAllCounters gets all of a bot's counters
+func GetAllCounters(botBucket []byte) ([]*Counter, error) {
+	counters := []*Counter{}
+	err := db.DB.View(func(tx *bolt.Tx) error {
+		bkt, err := buckets.Counters(tx, botBucket)
+		if err == buckets.ErrBucketNotFound {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		return bkt.ForEach(func(k, _ []byte) error {
+			v, err := buckets.GetInt64(bkt.Bucket, k)
+			if err != nil {
+				return nil
+			}
+			counters = append(counters, &Counter{Name: string(k), Value: v})
+			return nil
+		})
+	})
+	if err != nil {
+		log.Printf("msg='error-getting-counters', error='%v', botBucket='%s'\n", err, string(botBucket))
+		return nil, err
+	}
+
+	return counters, nil
+}
+
+// DeleteCounter deletes a counter
+func DeleteCounter(botBucket []byte, name string) error {
+	return deleteKey(botBucket, buckets.Counters, Name(name))
+}
+
+// GetVar gets a variable's value
+func GetVar(botBucket []byte, name string) (string, error) {
+	var v []byte
+	err := db.DB.View(func(tx *bolt.Tx) error {
+		bkt, err := buckets.Variables(tx, botBucket)
+		if err == buckets.ErrBucketNotFound {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if b := bkt.Get([]byte(Name(name))); b != nil {
+			v = append([]byte{}, b...)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("msg='error-getting-variable', error='%v', botBucket='%s', name='%s'\n", err, string(botBucket), name)
+		return "", err
+	}
+
+	if v == nil {
+		return "", ErrNotFound
+	}
+	return string(v), nil
+}
+
+// Save saves the variable
+func (v *Variable) Save(botBucket []byte) error {
+	v.Name = Name(v.Name)
+	err := db.DB.Update(func(tx *bolt.Tx) error {
+		bkt, err := buckets.Variables(tx, botBucket)
+		if err != nil {
+			return err
+		}
+
+		return bkt.Put([]byte(v.Name), []byte(v.Value))
+	})
+	if err != nil {
+		log.Printf("msg='error-saving-variable', error='%v', botBucket='%s', name='%s'\n", err, string(botBucket), v.Name)
+		return err
+	}
+
+	return nil
+}
+
+// GetAllVars gets all of a bot's variables
+func GetAllVars(botBucket []byte) ([]*Variable, error) {
+	vars := []*Variable{}
+	err := db.DB.View(func(tx *bolt.Tx) error {
+		bkt, err := buckets.Variables(tx, botBucket)
+		if err == buckets.ErrBucketNotFound {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		return bkt.ForEach(func(k, v []byte) error {
+			vars = append(vars, &Variable{Name: string(k), Value: string(v)})
+			return nil
+		})
+	})
+	if err != nil {
+		log.Printf("msg='error-getting-variables', error='%v', botBucket='%s'\n", err, string(botBucket))
+		return nil, err
+	}
+
+	return vars, nil
+}
+
+// DeleteVar deletes a variable
+func DeleteVar(botBucket []byte, name string) error {
+	return deleteKey(botBucket, buckets.Variables, Name(name))
+}
+
+func deleteKey(botBucket []byte, bucket func(*bolt.Tx, []byte) (buckets.Bucket, error), name string) error {
+	err := db.DB.Update(func(tx *bolt.Tx) error {
+		bkt, err := bucket(tx, botBucket)
+		if err != nil {
+			return err
+		}
+
+		if bkt.Get([]byte(name)) == nil {
+			return ErrNotFound
+		}
+		return bkt.Delete([]byte(name))
+	})
+	if err != nil && err != ErrNotFound {
+		log.Printf("msg='error-deleting-variable', error='%v', botBucket='%s', name='%s'\n", err, string(botBucket), name)
+	}
+
+	return err
+}
@@ -0,0 +1,136 @@
+/*
+* Package viewers stores information about the viewers of a bot's chat
+ */
+package viewers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/StreamMeBots/meep/pkg/buckets"
+	"github.com/StreamMeBots/meep/pkg/db"
+
+	"github.com/boltdb/bolt"
+)
+
+// TagRegular is the tag given to a bot's regular viewers
+var TagRegular = "regular"
+
+// Tags are the tags given to a viewer, e.g. regular or subscriber
+type Tags struct {
+	UserPublicId string   `json:"userPublicId"`
+	Username     string   `json:"username,omitempty"`
+	Tags         []string `json:"tags"`
+}
+
+func (t *Tags) BucketKey() []byte {
+	return []byte(t.UserPublicId)
+}
+
+// Has checks if the viewer has the tag
+func (t *Tags) Has(tag string) bool {
+	for _, tg := range t.Tags {
+		if strings.EqualFold(tg, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate validates the Tags
+func (t *Tags) Validate() error {
+	if len(t.UserPublicId) == 0 {
+		return fmt.Errorf("userPublicId is required")
+	}
+	if len(t.Tags) > 50 {
+		return fmt.Errorf("A viewer can have at most 50 tags")
+	}
+	for _, tg := range t.Tags {
+		if len(tg) == 0 || len(tg) > 50 || strings.ContainsAny(tg, " \t") {
+			return fmt.Errorf("Tags should be between 1 and 50 characters without spaces")
+		}
+	}
+	return nil
+}
+
+// Save saves the viewer's tags. Saving no tags removes the viewer.
+func (t *Tags) Save(botBucket []byte) error {
+	err := db.DB.Update(func(tx *bolt.Tx) error {
+		bkt, err := buckets.ViewerTags(tx, botBucket)
+		if err != nil {
+			return err
+		}
+
+		if len(t.Tags) == 0 {
+			return bkt.Delete(t.BucketKey())
+		}
+
+		b, err := json.Marshal(t)
+		if err != nil {
+			return err
+		}
+		return bkt.Put(t.BucketKey(), b)
+	})
+	if err != nil {
+		log.Printf("msg='error-saving-viewer-tags', error='%v', botBucket='%s'\n", err, string(botBucket))
+		return err
+	}
+
+	return nil
+}
+
+// GetTags gets a viewer's tags
+func GetTags(botBucket []byte, userPublicId string) (*Tags, error) {
+	t := &Tags{UserPublicId: userPublicId, Tags: []string{}}
+	err := db.DB.View(func(tx *bolt.Tx) error {
+		bkt, err := buckets.ViewerTags(tx, botBucket)
+		if err == buckets.ErrBucketNotFound {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		b := bkt.Get(t.BucketKey())
+		if b == nil {
+			return nil
+		}
+		return json.Unmarshal(b, &t)
+	})
+	if err != nil {
+		log.Printf("msg='error-getting-viewer-tags', error='%v', botBucket='%s'\n", err, string(botBucket))
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// GetAllTags gets the tags of every viewer that has any
+func GetAllTags(botBucket []byte) ([]*Tags, error) {
+	all := []*Tags{}
+	err := db.DB.View(func(tx *bolt.Tx) error {
+		bkt, err := buckets.ViewerTags(tx, botBucket)
+		if err == buckets.ErrBucketNotFound {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		return bkt.ForEach(func(k, v []byte) error {
+			t := &Tags{}
+			if err := json.Unmarshal(v, &t); err != nil {
+				log.Printf("msg='json-unmarshal-error', key='%s', error='%v'\n", string(k), err)
+				return nil
+			}
+			all = append(all, t)
+			return nil
+		})
+	})
+	if err != nil {
+		log.Printf("msg='error-getting-viewer-tags', error='%v', botBucket='%s'\n", err, string(botBucket))
+		return nil, err
+	}
+
+	return all, nil
+}
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/StreamMeBots/meep/pkg/config"
+	"github.com/StreamMeBots/meep/pkg/session"
 	"github.com/StreamMeBots/meep/pkg/user"
 	"github.com/gin-gonic/gin"
 	"golang.org/x/oauth2"
@@ -20,7 +21,11 @@ var (
 	userKey     = "user"
 )
 
-// UserClients is used to store a user's authorized http client
+// SessionCleanupInterval is how often expired sessions are deleted
+var SessionCleanupInterval = time.Hour
+
+// UserClients is used to cache a session's user and authorized http client. Sessions are loaded from the db the
+// first time they are used.
 type UserClients struct {
 	sync.RWMutex
 	clients map[string]UserClient
@@ -28,26 +33,72 @@ type UserClients struct {
 
 // UserClient contains the user info and the authed client used to interact with stream.me
 type UserClient struct {
-	client *http.Client
-	User   user.User
-	Token  string
+	client  *http.Client
+	User    user.User
+	session *session.Session
 }
 
 // Get a user's http client
 func (uc *UserClients) Get(sessid string) (UserClient, bool) {
+	if len(sessid) == 0 {
+		return UserClient{}, false
+	}
+
 	uc.RLock()
-	defer uc.RUnlock()
 	c, ok := uc.clients[sessid]
-	return c, ok
+	uc.RUnlock()
+	if ok {
+		if c.session.Expired() {
+			uc.Remove(sessid)
+			return UserClient{}, false
+		}
+		return c, true
+	}
+
+	// rebuild the client from the saved session
+	s, err := session.Get(sessid)
+	if err != nil {
+		return UserClient{}, false
+	}
+	u, err := user.Get(s.UserPublicId)
+	if err != nil {
+		return UserClient{}, false
+	}
+
+	return uc.Add(s, *u), true
 }
 
 // Add a user's http client
-func (uc *UserClients) Add(sessid string, u user.User, client *http.Client) {
+func (uc *UserClients) Add(s *session.Session, u user.User) UserClient {
+	c := UserClient{
+		User:    u,
+		session: s,
+		client:  oauth2.NewClient(oauth2.NoContext, s.TokenSource(&auth.conf)),
+	}
+
+	uc.Lock()
+	defer uc.Unlock()
+	uc.clients[s.Id] = c
+	return c
+}
+
+// Remove a session's client
+func (uc *UserClients) Remove(sessid string) {
 	uc.Lock()
 	defer uc.Unlock()
-	uc.clients[sessid] = UserClient{
-		User:   u,
-		client: client,
+	delete(uc.clients, sessid)
+}
+
+// cleanupSessions periodically deletes expired sessions
+func cleanupSessions() {
+	for range time.Tick(SessionCleanupInterval) {
+		ids, err := session.DeleteExpired()
+		if err != nil {
+			continue
+		}
+		for _, id := range ids {
+			userClients.Remove(id)
+		}
 	}
 }
 
@@ -85,7 +136,17 @@ func (a *authConfig) loginHandler(ctx *gin.Context) {
 		return
 	}
 
-	url := a.conf.AuthCodeURL("fooBarBaz")
+	// the state protects the redirect from login CSRF
+	state, err := setStateCookie(ctx, safeNext(ctx.Request.FormValue("next")))
+	if err != nil {
+		log.Printf("msg='error-creating-oauth-state', error='%v'\n", err)
+		ctx.JSON(500, map[string]string{
+			"message": "Internal server error",
+		})
+		return
+	}
+
+	url := a.conf.AuthCodeURL(state)
 	Debugln("AuthCodeURL:", url)
 	ctx.Redirect(302, url)
 }
@@ -99,6 +160,13 @@ func (a *authConfig) redirectHandler(ctx *gin.Context) {
 		return
 	}
 
+	// make sure this login was started by us for this browser
+	st, ok := checkStateCookie(ctx, ctx.Request.FormValue("state"))
+	if !ok {
+		ctx.Redirect(302, fmt.Sprintf("%s/?error='Invalid login state, please try again'", config.Conf.Host()))
+		return
+	}
+
 	// get auth code
 	code := ctx.Request.FormValue("code")
 
@@ -110,8 +178,16 @@ func (a *authConfig) redirectHandler(ctx *gin.Context) {
 		return
 	}
 
+	// create a session that keeps the user's token
+	sess, err := session.New("", ctx.Request.UserAgent(), ctx.ClientIP(), tok)
+	if err != nil {
+		log.Printf("msg='error-creating-session', error='%v'\n", err)
+		ctx.Redirect(302, fmt.Sprintf("%s/?error='Unable to create a session'", config.Conf.Host()))
+		return
+	}
+
 	// create authorized client
-	client := a.conf.Client(oauth2.NoContext, tok)
+	client := oauth2.NewClient(oauth2.NoContext, sess.TokenSource(&a.conf))
 
 	// get user from stream.me using the authed client
 	u, err := user.GetByClient(client, ctx.Request.RemoteAddr)
@@ -119,26 +195,41 @@ func (a *authConfig) redirectHandler(ctx *gin.Context) {
 		ctx.Redirect(302, fmt.Sprintf("%s/?error='Unable to get user from stream.me'", config.Conf.Host()))
 		return
 	}
+	sess.UserPublicId = u.PublicId
 
 	// save user info
 	if err := u.Save(); err != nil {
 		ctx.JSON(500, map[string]string{
 			"message": "Error saving user information",
 		})
+		return
+	}
+
+	// save the session so the user stays logged in across restarts
+	if err := sess.Save(); err != nil {
+		ctx.JSON(500, map[string]string{
+			"message": "Error saving session",
+		})
+		return
 	}
 
 	// save the user
-	userClients.Add(u.SessId, *u, client)
+	userClients.Add(sess, *u)
 
 	// write session cookie
-	http.SetCookie(ctx.Writer, &http.Cookie{
-		Name:    "sessid",
-		Value:   u.SessId,
-		Path:    "/",
-		Expires: time.Now().Add(time.Hour * 24 * 30),
-	})
-
-	ctx.Redirect(302, config.Conf.Host())
+	setCookie(ctx, sessionCookie, sess.Id, session.Duration)
+
+	ctx.Redirect(302, config.Conf.Host()+st.Next)
+}
+
+// savedClient recreates a user's authorized client from the token of their latest session
+func (a *authConfig) savedClient(userPublicId string) (*http.Client, error) {
+	s, err := session.Latest(userPublicId)
+	if err != nil {
+		return nil, err
+	}
+
+	return oauth2.NewClient(oauth2.NoContext, s.TokenSource(&a.conf)), nil
 }
 
 // isUserAuthed is a helper function to check if the user is already authenticated
@@ -148,7 +239,7 @@ func isUserAuthed(ctx *gin.Context) bool {
 }
 
 func getSessId(ctx *gin.Context) string {
-	c, err := ctx.Request.Cookie("sessid")
+	c, err := ctx.Request.Cookie(sessionCookie)
 	if err != nil {
 		return ""
 	}
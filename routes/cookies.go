@@ -0,0 +1,118 @@
+package routes
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/StreamMeBots/meep/pkg/config"
+	"github.com/StreamMeBots/meep/pkg/session"
+	"github.com/gin-gonic/gin"
+)
+
+// cookie names
+var (
+	sessionCookie = "sessid"
+	stateCookie   = "oauthstate"
+)
+
+// StateDuration is how long a user has to finish logging in with stream.me
+var StateDuration = time.Minute * 10
+
+// oauthState is saved in the signed state cookie while the user logs in with stream.me
+type oauthState struct {
+	State   string    `json:"state"`
+	Next    string    `json:"next"`
+	Expires time.Time `json:"expires"`
+}
+
+// isSecure checks if the request was made over https. When the server is behind a proxy the proxy's
+// X-Forwarded-Proto header is trusted.
+func isSecure(r *http.Request) bool {
+	if r.TLS != nil {
+		return true
+	}
+	return config.Conf.ServerBehindProxy && r.Header.Get("X-Forwarded-Proto") == "https"
+}
+
+// setCookie writes a hardened cookie. A negative maxAge deletes the cookie.
+func setCookie(ctx *gin.Context, name, value string, maxAge time.Duration) {
+	c := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   isSecure(ctx.Request),
+		// lax so the cookies are sent when stream.me redirects back to us
+		SameSite: http.SameSiteLaxMode,
+	}
+	if maxAge < 0 {
+		c.MaxAge = -1
+	} else {
+		c.MaxAge = int(maxAge.Seconds())
+		c.Expires = time.Now().Add(maxAge)
+	}
+
+	http.SetCookie(ctx.Writer, c)
+}
+
+// setStateCookie creates a new random oauth state and saves it in a signed cookie
+func setStateCookie(ctx *gin.Context, next string) (string, error) {
+	state, err := session.RandomId(16)
+	if err != nil {
+		return "", err
+	}
+
+	b, err := json.Marshal(oauthState{
+		State:   state,
+		Next:    next,
+		Expires: time.Now().Add(StateDuration),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	signed, err := session.Sign(b)
+	if err != nil {
+		return "", err
+	}
+
+	setCookie(ctx, stateCookie, signed, StateDuration)
+	return state, nil
+}
+
+// checkStateCookie verifies the oauth state returned by stream.me against the state cookie. The state cookie
+// is removed since each state can only be used once.
+func checkStateCookie(ctx *gin.Context, state string) (oauthState, bool) {
+	st := oauthState{}
+
+	c, err := ctx.Request.Cookie(stateCookie)
+	if err != nil {
+		return st, false
+	}
+	setCookie(ctx, stateCookie, "", -1)
+
+	b, err := session.Verify(c.Value)
+	if err != nil {
+		return st, false
+	}
+	if err := json.Unmarshal(b, &st); err != nil {
+		return st, false
+	}
+
+	if len(state) == 0 || subtle.ConstantTimeCompare([]byte(st.State), []byte(state)) != 1 || time.Now().After(st.Expires) {
+		return st, false
+	}
+
+	return st, true
+}
+
+// safeNext only allows local paths to be used as a return path so the login can't redirect to another site
+func safeNext(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.ContainsAny(next, "\\\r\n") {
+		return "/"
+	}
+	return next
+}
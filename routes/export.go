@@ -0,0 +1,145 @@
+package routes
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/StreamMeBots/meep/pkg/stats"
+	"github.com/StreamMeBots/meep/pkg/transcripts"
+)
+
+// exportFlushRows is how many rows are written between flushes so the client gets the export as it's read
+var exportFlushRows = 100
+
+// exportWriter streams rows as NDJSON or CSV
+type exportWriter struct {
+	w    gin.ResponseWriter
+	csv  *csv.Writer // nil when writing NDJSON
+	json *json.Encoder
+	rows int
+}
+
+// newExportWriter starts the response for the ?format= of the request, ndjson or csv. name is the file name without
+// an extension. false is returned if the request was invalid and has been responded to.
+func newExportWriter(ctx *gin.Context, name string, header []string) (*exportWriter, bool) {
+	ew := &exportWriter{w: ctx.Writer}
+
+	switch ctx.FormValue("format") {
+	case "", "ndjson":
+		ctx.Header("Content-Type", "application/x-ndjson; charset=utf-8")
+		ctx.Header("Content-Disposition", `attachment; filename="`+name+`.ndjson"`)
+		ew.json = json.NewEncoder(ctx.Writer)
+	case "csv":
+		ctx.Header("Content-Type", "text/csv; charset=utf-8")
+		ctx.Header("Content-Disposition", `attachment; filename="`+name+`.csv"`)
+		ew.csv = csv.NewWriter(ctx.Writer)
+	default:
+		ctx.JSON(400, map[string]string{
+			"message": "format should be ndjson or csv",
+		})
+		return nil, false
+	}
+
+	ctx.Writer.WriteHeader(200)
+	if ew.csv != nil {
+		if err := ew.csv.Write(header); err != nil {
+			log.Printf("msg='error-writing-export', error='%v'\n", err)
+		}
+	}
+	return ew, true
+}
+
+// write writes a row, v is the NDJSON line and row the CSV columns
+func (ew *exportWriter) write(v interface{}, row []string) error {
+	var err error
+	if ew.csv != nil {
+		err = ew.csv.Write(row)
+	} else {
+		err = ew.json.Encode(v)
+	}
+	if err != nil {
+		return err
+	}
+
+	ew.rows++
+	if ew.rows%exportFlushRows == 0 {
+		ew.flush()
+	}
+	return nil
+}
+
+func (ew *exportWriter) flush() {
+	if ew.csv != nil {
+		ew.csv.Flush()
+	}
+	ew.w.Flush()
+}
+
+// exportRange parses the ?from= and ?to= RFC3339 times of an export. false is returned if the request was invalid
+// and has been responded to.
+func exportRange(ctx *gin.Context) (from, to time.Time, ok bool) {
+	var err error
+	if from, err = parseTime(ctx.FormValue("from")); err != nil {
+		ctx.JSON(400, map[string]string{
+			"message": "from should be an RFC3339 time",
+		})
+		return from, to, false
+	}
+	if to, err = parseTime(ctx.FormValue("to")); err != nil {
+		ctx.JSON(400, map[string]string{
+			"message": "to should be an RFC3339 time",
+		})
+		return from, to, false
+	}
+	return from, to, true
+}
+
+// exportTranscript streams the chat transcript oldest first. ?format= is ndjson or csv and ?from= and ?to= are
+// RFC3339 times.
+func exportTranscript(ctx *gin.Context) {
+	u := getAuthedUser(ctx)
+
+	from, to, ok := exportRange(ctx)
+	if !ok {
+		return
+	}
+	ew, ok := newExportWriter(ctx, "transcript", transcripts.CSVHeader)
+	if !ok {
+		return
+	}
+
+	err := transcripts.Export(u.User.BucketKey(), from, to, func(e *transcripts.Entry) error {
+		return ew.write(e, e.CSV())
+	})
+	if err != nil {
+		log.Printf("msg='error-exporting-transcript', userPublicId='%s', error='%v'\n", u.User.PublicId, err)
+	}
+	ew.flush()
+}
+
+// exportStats streams the line and command stats by day and by hour. ?format= is ndjson or csv and ?from= and ?to=
+// are RFC3339 times.
+func exportStats(ctx *gin.Context) {
+	u := getAuthedUser(ctx)
+
+	from, to, ok := exportRange(ctx)
+	if !ok {
+		return
+	}
+	ew, ok := newExportWriter(ctx, "stats", stats.CSVHeader)
+	if !ok {
+		return
+	}
+
+	err := stats.Export(u.User.BucketKey(), from, to, func(r *stats.Row) error {
+		return ew.write(r, r.CSV())
+	})
+	if err != nil {
+		log.Printf("msg='error-exporting-stats', userPublicId='%s', error='%v'\n", u.User.PublicId, err)
+	}
+	ew.flush()
+}
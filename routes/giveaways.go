@@ -0,0 +1,122 @@
+package routes
+
+import (
+	"encoding/json"
+	"log"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/StreamMeBots/meep/pkg/bot"
+	"github.com/StreamMeBots/meep/pkg/giveaways"
+)
+
+// getGiveaways gets the giveaways without their entries
+func getGiveaways(ctx *gin.Context) {
+	u := getAuthedUser(ctx)
+
+	gs, err := giveaways.GetAll(u.User.BucketKey())
+	if err != nil {
+		ctx.JSON(500, map[string]string{
+			"message": "Internal server error",
+		})
+		return
+	}
+
+	ctx.JSON(200, gs)
+}
+
+// getGiveaway gets a giveaway with all of its entries and winners
+func getGiveaway(ctx *gin.Context) {
+	u := getAuthedUser(ctx)
+
+	id, err := strconv.ParseUint(ctx.ParamValue("id"), 10, 64)
+	if err == nil {
+		var g *giveaways.Giveaway
+		if g, err = giveaways.Get(u.User.BucketKey(), id); err == nil {
+			ctx.JSON(200, g)
+			return
+		}
+	} else {
+		err = giveaways.ErrGiveawayNotFound
+	}
+
+	if err == giveaways.ErrGiveawayNotFound {
+		ctx.JSON(404, map[string]string{
+			"message": "Giveaway not found",
+		})
+		return
+	}
+	ctx.JSON(500, map[string]string{
+		"message": "Internal server error",
+	})
+}
+
+func startGiveaway(ctx *gin.Context) {
+	u := getAuthedUser(ctx)
+
+	g := &giveaways.Giveaway{}
+	if err := json.NewDecoder(ctx.Request.Body).Decode(&g); err != nil {
+		log.Printf("msg='json-decode-error', error='%v'\n", err)
+		ctx.JSON(400, map[string]string{
+			"message": "Invalid JSON body",
+		})
+		return
+	}
+	g.Id = 0
+	g.CreatedBy = u.User.Username
+
+	if err := g.Validate(); err != nil {
+		ctx.JSON(422, map[string]string{
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if err := Bots.StartGiveaway(u.User.PublicId, g); err != nil {
+		giveawayError(ctx, err)
+		return
+	}
+
+	ctx.JSON(200, g.Snapshot())
+}
+
+// drawGiveaway draws a winner of the running giveaway, ?redraw=true marks the last winner as redrawn
+func drawGiveaway(ctx *gin.Context) {
+	u := getAuthedUser(ctx)
+
+	w, err := Bots.DrawGiveaway(u.User.PublicId, ctx.FormValue("redraw") == "true")
+	if err != nil {
+		giveawayError(ctx, err)
+		return
+	}
+
+	ctx.JSON(200, w)
+}
+
+func endGiveaway(ctx *gin.Context) {
+	u := getAuthedUser(ctx)
+
+	if err := Bots.EndGiveaway(u.User.PublicId); err != nil {
+		giveawayError(ctx, err)
+		return
+	}
+
+	ctx.JSON(200, map[string]string{
+		"message": "Giveaway has ended",
+	})
+}
+
+// giveawayError responds with the error of a running giveaway
+func giveawayError(ctx *gin.Context, err error) {
+	switch err {
+	case bot.ErrBotNotRunning, bot.ErrGiveawayRunning, bot.ErrNoGiveaway, giveaways.ErrNoEntries:
+		ctx.JSON(409, map[string]string{
+			"message": err.Error(),
+		})
+	default:
+		ctx.JSON(500, map[string]string{
+			"message": "Internal server error",
+		})
+	}
+}
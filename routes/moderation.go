@@ -0,0 +1,329 @@
+package routes
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/StreamMeBots/meep/pkg/bot"
+	"github.com/StreamMeBots/meep/pkg/moderation"
+)
+
+func getFilters(ctx *gin.Context) {
+	u := getAuthedUser(ctx)
+
+	filters, err := moderation.GetAll(u.User.BucketKey())
+	if err != nil {
+		ctx.JSON(500, map[string]string{
+			"message": "Internal server error",
+		})
+		return
+	}
+
+	ctx.JSON(200, filters)
+}
+
+func getFilter(ctx *gin.Context) {
+	u := getAuthedUser(ctx)
+
+	f, err := moderation.Get(u.User.BucketKey(), ctx.ParamValue("name"))
+	if err == moderation.ErrFilterNotFound {
+		ctx.JSON(404, map[string]string{
+			"message": err.Error(),
+		})
+		return
+	} else if err != nil {
+		ctx.JSON(500, map[string]string{
+			"message": "Internal server error",
+		})
+		return
+	}
+
+	ctx.JSON(200, f)
+}
+
+func saveFilter(ctx *gin.Context) {
+	u := getAuthedUser(ctx)
+
+	f := &moderation.Filter{}
+	if err := json.NewDecoder(ctx.Request.Body).Decode(&f); err != nil {
+		log.Printf("msg='json-decode-error', error='%v'\n", err)
+		ctx.JSON(400, map[string]string{
+			"message": "Invalid JSON body",
+		})
+		return
+	}
+
+	if err := f.Validate(); err != nil {
+		ctx.JSON(422, map[string]string{
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if err := f.Save(u.User.BucketKey()); err != nil {
+		ctx.JSON(500, map[string]string{
+			"message": "Internal server error",
+		})
+		return
+	}
+
+	Bots.ReloadModeration(u.User.PublicId)
+
+	ctx.JSON(200, f)
+}
+
+func deleteFilter(ctx *gin.Context) {
+	u := getAuthedUser(ctx)
+
+	if err := moderation.Delete(u.User.BucketKey(), ctx.ParamValue("name")); err != nil {
+		ctx.JSON(500, map[string]string{
+			"message": "Internal server error",
+		})
+		return
+	}
+
+	Bots.ReloadModeration(u.User.PublicId)
+
+	ctx.JSON(200, map[string]string{
+		"message": "Filter has been deleted",
+	})
+}
+
+func getLadder(ctx *gin.Context) {
+	u := getAuthedUser(ctx)
+
+	l, err := moderation.GetLadder(u.User.BucketKey())
+	if err != nil {
+		ctx.JSON(500, map[string]string{
+			"message": "Internal server error",
+		})
+		return
+	}
+
+	ctx.JSON(200, l)
+}
+
+func saveLadder(ctx *gin.Context) {
+	u := getAuthedUser(ctx)
+
+	l := &moderation.Ladder{}
+	if err := json.NewDecoder(ctx.Request.Body).Decode(&l); err != nil {
+		log.Printf("msg='json-decode-error', error='%v'\n", err)
+		ctx.JSON(400, map[string]string{
+			"message": "Invalid JSON body",
+		})
+		return
+	}
+
+	if err := l.Validate(); err != nil {
+		ctx.JSON(422, map[string]string{
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if err := l.Save(u.User.BucketKey()); err != nil {
+		log.Printf("msg='error-saving-ladder', userPublicId='%s', error='%v'\n", u.User.PublicId, err)
+		ctx.JSON(500, map[string]string{
+			"message": "Internal server error",
+		})
+		return
+	}
+
+	ctx.JSON(200, l)
+}
+
+func getStrikes(ctx *gin.Context) {
+	u := getAuthedUser(ctx)
+
+	strikes, err := moderation.GetAllStrikes(u.User.BucketKey())
+	if err != nil {
+		ctx.JSON(500, map[string]string{
+			"message": "Internal server error",
+		})
+		return
+	}
+
+	ctx.JSON(200, strikes)
+}
+
+func getViewerStrikes(ctx *gin.Context) {
+	u := getAuthedUser(ctx)
+
+	strikes, err := moderation.GetStrikes(u.User.BucketKey(), ctx.ParamValue("publicId"))
+	if err != nil {
+		ctx.JSON(500, map[string]string{
+			"message": "Internal server error",
+		})
+		return
+	}
+
+	ctx.JSON(200, strikes)
+}
+
+func addStrike(ctx *gin.Context) {
+	u := getAuthedUser(ctx)
+
+	body := struct {
+		UserPublicId string `json:"userPublicId"`
+		Username     string `json:"username"`
+		Reason       string `json:"reason"`
+	}{}
+	if err := json.NewDecoder(ctx.Request.Body).Decode(&body); err != nil {
+		log.Printf("msg='json-decode-error', error='%v'\n", err)
+		ctx.JSON(400, map[string]string{
+			"message": "Invalid JSON body",
+		})
+		return
+	}
+
+	if len(body.UserPublicId) == 0 {
+		ctx.JSON(422, map[string]string{
+			"message": "userPublicId is required",
+		})
+		return
+	}
+
+	count, err := Bots.Strike(u.User.PublicId, moderation.Offense{
+		UserPublicId: body.UserPublicId,
+		Username:     body.Username,
+		Reason:       body.Reason,
+		Source:       "moderator:" + u.User.Username,
+	})
+	if err == bot.ErrBotNotRunning {
+		ctx.JSON(409, map[string]string{
+			"message": err.Error(),
+		})
+		return
+	} else if err != nil {
+		ctx.JSON(500, map[string]string{
+			"message": "Internal server error",
+		})
+		return
+	}
+
+	ctx.JSON(200, map[string]interface{}{
+		"userPublicId": body.UserPublicId,
+		"strikes":      count,
+	})
+}
+
+func clearStrikes(ctx *gin.Context) {
+	u := getAuthedUser(ctx)
+
+	if err := moderation.ClearStrikes(u.User.BucketKey(), ctx.ParamValue("publicId")); err != nil {
+		ctx.JSON(500, map[string]string{
+			"message": "Internal server error",
+		})
+		return
+	}
+
+	ctx.JSON(200, map[string]string{
+		"message": "Strikes have been cleared",
+	})
+}
+
+func getTimeouts(ctx *gin.Context) {
+	u := getAuthedUser(ctx)
+
+	timeouts, err := moderation.GetTimeouts(u.User.BucketKey())
+	if err != nil {
+		ctx.JSON(500, map[string]string{
+			"message": "Internal server error",
+		})
+		return
+	}
+
+	// only list the timeouts that are still going
+	active := []*moderation.Timeout{}
+	for _, t := range timeouts {
+		if !t.Expired() {
+			active = append(active, t)
+		}
+	}
+
+	ctx.JSON(200, active)
+}
+
+func addTimeout(ctx *gin.Context) {
+	u := getAuthedUser(ctx)
+
+	body := struct {
+		UserPublicId string `json:"userPublicId"`
+		Username     string `json:"username"`
+		Role         string `json:"role"` // the viewer's chat role, the bot's last seen role is used if it's empty
+		Duration     string `json:"duration"`
+	}{}
+	if err := json.NewDecoder(ctx.Request.Body).Decode(&body); err != nil {
+		log.Printf("msg='json-decode-error', error='%v'\n", err)
+		ctx.JSON(400, map[string]string{
+			"message": "Invalid JSON body",
+		})
+		return
+	}
+
+	if len(body.UserPublicId) == 0 {
+		ctx.JSON(422, map[string]string{
+			"message": "userPublicId is required",
+		})
+		return
+	}
+	d, err := moderation.ParseDuration(body.Duration)
+	if err != nil {
+		ctx.JSON(422, map[string]string{
+			"message": err.Error(),
+		})
+		return
+	}
+
+	t := &moderation.Timeout{
+		UserPublicId: body.UserPublicId,
+		Username:     body.Username,
+		Role:         body.Role,
+		By:           u.User.Username,
+		Created:      time.Now(),
+		Expires:      time.Now().Add(d),
+	}
+	if err := Bots.Timeout(u.User.PublicId, t); err == bot.ErrBotNotRunning {
+		ctx.JSON(409, map[string]string{
+			"message": err.Error(),
+		})
+		return
+	} else if err != nil {
+		ctx.JSON(500, map[string]string{
+			"message": "Internal server error",
+		})
+		return
+	}
+
+	ctx.JSON(200, t)
+}
+
+func cancelTimeout(ctx *gin.Context) {
+	u := getAuthedUser(ctx)
+
+	err := Bots.CancelTimeout(u.User.PublicId, ctx.ParamValue("publicId"))
+	if err == bot.ErrBotNotRunning {
+		ctx.JSON(409, map[string]string{
+			"message": err.Error(),
+		})
+		return
+	} else if err == moderation.ErrTimeoutNotFound {
+		ctx.JSON(404, map[string]string{
+			"message": err.Error(),
+		})
+		return
+	} else if err != nil {
+		ctx.JSON(500, map[string]string{
+			"message": "Internal server error",
+		})
+		return
+	}
+
+	ctx.JSON(200, map[string]string{
+		"message": "Timeout has been cancelled",
+	})
+}
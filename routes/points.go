@@ -0,0 +1,120 @@
+package routes
+
+import (
+	"encoding/json"
+	"log"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/StreamMeBots/meep/pkg/points"
+)
+
+// MaxLedgerEntries is the most ledger entries returned at once
+var MaxLedgerEntries = 200
+
+func getPointsSettings(ctx *gin.Context) {
+	u := getAuthedUser(ctx)
+
+	s, err := points.GetSettings(u.User.BucketKey())
+	if err != nil {
+		ctx.JSON(500, map[string]string{
+			"message": "Internal server error",
+		})
+		return
+	}
+
+	ctx.JSON(200, s)
+}
+
+func savePointsSettings(ctx *gin.Context) {
+	u := getAuthedUser(ctx)
+
+	s := &points.Settings{}
+	if err := json.NewDecoder(ctx.Request.Body).Decode(&s); err != nil {
+		log.Printf("msg='json-decode-error', error='%v'\n", err)
+		ctx.JSON(400, map[string]string{
+			"message": "Invalid JSON body",
+		})
+		return
+	}
+
+	if err := s.Validate(); err != nil {
+		ctx.JSON(422, map[string]string{
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if err := s.Save(u.User.BucketKey()); err != nil {
+		ctx.JSON(500, map[string]string{
+			"message": "Internal server error",
+		})
+		return
+	}
+
+	ctx.JSON(200, s)
+}
+
+// getPoints gets the balances from highest to lowest, ?limit=n gets the top n
+func getPoints(ctx *gin.Context) {
+	u := getAuthedUser(ctx)
+
+	limit := 0
+	if l := ctx.FormValue("limit"); len(l) > 0 {
+		var err error
+		if limit, err = strconv.Atoi(l); err != nil || limit < 0 {
+			ctx.JSON(400, map[string]string{
+				"message": "Invalid limit",
+			})
+			return
+		}
+	}
+
+	accounts, err := points.GetAccounts(u.User.BucketKey(), limit)
+	if err != nil {
+		ctx.JSON(500, map[string]string{
+			"message": "Internal server error",
+		})
+		return
+	}
+
+	ctx.JSON(200, accounts)
+}
+
+// getPointsLedger gets the ledger newest first. ?user=publicId filters by viewer, ?before=id gets the next page.
+func getPointsLedger(ctx *gin.Context) {
+	u := getAuthedUser(ctx)
+
+	limit := 50
+	if l := ctx.FormValue("limit"); len(l) > 0 {
+		var err error
+		if limit, err = strconv.Atoi(l); err != nil || limit < 1 || limit > MaxLedgerEntries {
+			ctx.JSON(400, map[string]string{
+				"message": "limit should be between 1 and " + strconv.Itoa(MaxLedgerEntries),
+			})
+			return
+		}
+	}
+
+	var before uint64
+	if b := ctx.FormValue("before"); len(b) > 0 {
+		var err error
+		if before, err = strconv.ParseUint(b, 10, 64); err != nil {
+			ctx.JSON(400, map[string]string{
+				"message": "Invalid before",
+			})
+			return
+		}
+	}
+
+	entries, err := points.GetLedger(u.User.BucketKey(), ctx.FormValue("user"), before, limit)
+	if err != nil {
+		ctx.JSON(500, map[string]string{
+			"message": "Internal server error",
+		})
+		return
+	}
+
+	ctx.JSON(200, entries)
+}
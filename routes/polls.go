@@ -0,0 +1,89 @@
+package routes
+
+import (
+	"encoding/json"
+	"log"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/StreamMeBots/meep/pkg/bot"
+	"github.com/StreamMeBots/meep/pkg/polls"
+)
+
+// getPolls gets the finished polls
+func getPolls(ctx *gin.Context) {
+	u := getAuthedUser(ctx)
+
+	ps, err := polls.GetAll(u.User.BucketKey())
+	if err != nil {
+		ctx.JSON(500, map[string]string{
+			"message": "Internal server error",
+		})
+		return
+	}
+
+	ctx.JSON(200, ps)
+}
+
+func getActivePoll(ctx *gin.Context) {
+	u := getAuthedUser(ctx)
+
+	p, err := Bots.ActivePoll(u.User.PublicId)
+	if err == bot.ErrBotNotRunning || err == bot.ErrNoPollRunning {
+		ctx.JSON(404, map[string]string{
+			"message": err.Error(),
+		})
+		return
+	} else if err != nil {
+		ctx.JSON(500, map[string]string{
+			"message": "Internal server error",
+		})
+		return
+	}
+
+	ctx.JSON(200, p)
+}
+
+// startPoll starts a poll, the body is a poll with a question, options and a duration in seconds
+func startPoll(ctx *gin.Context) {
+	u := getAuthedUser(ctx)
+
+	body := struct {
+		Question string   `json:"question"`
+		Options  []string `json:"options"`
+		Duration int      `json:"duration"`
+	}{}
+	if err := json.NewDecoder(ctx.Request.Body).Decode(&body); err != nil {
+		log.Printf("msg='json-decode-error', error='%v'\n", err)
+		ctx.JSON(400, map[string]string{
+			"message": "Invalid JSON body",
+		})
+		return
+	}
+
+	p := polls.New(body.Question, body.Options, 0, u.User.Username)
+	if body.Duration != 0 {
+		p.Duration = body.Duration
+	}
+	if err := p.Validate(); err != nil {
+		ctx.JSON(422, map[string]string{
+			"message": err.Error(),
+		})
+		return
+	}
+
+	err := Bots.StartPoll(u.User.PublicId, p)
+	if err == bot.ErrBotNotRunning || err == bot.ErrPollRunning {
+		ctx.JSON(409, map[string]string{
+			"message": err.Error(),
+		})
+		return
+	} else if err != nil {
+		ctx.JSON(500, map[string]string{
+			"message": "Internal server error",
+		})
+		return
+	}
+
+	ctx.JSON(200, p.Snapshot())
+}
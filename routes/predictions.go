@@ -0,0 +1,154 @@
+package routes
+
+import (
+	"encoding/json"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/StreamMeBots/meep/pkg/bot"
+	"github.com/StreamMeBots/meep/pkg/predictions"
+)
+
+// getPredictions gets the predictions without their bets, the running prediction is first
+func getPredictions(ctx *gin.Context) {
+	u := getAuthedUser(ctx)
+
+	ps, err := predictions.GetAll(u.User.BucketKey())
+	if err != nil {
+		ctx.JSON(500, map[string]string{
+			"message": "Internal server error",
+		})
+		return
+	}
+
+	ctx.JSON(200, ps)
+}
+
+// getPrediction gets a prediction with all of its bets and payouts
+func getPrediction(ctx *gin.Context) {
+	u := getAuthedUser(ctx)
+
+	id, err := strconv.ParseUint(ctx.ParamValue("id"), 10, 64)
+	if err == nil {
+		var p *predictions.Prediction
+		if p, err = predictions.Get(u.User.BucketKey(), id); err == nil {
+			ctx.JSON(200, p)
+			return
+		}
+	} else {
+		err = predictions.ErrPredictionNotFound
+	}
+
+	if err == predictions.ErrPredictionNotFound {
+		ctx.JSON(404, map[string]string{
+			"message": "Prediction not found",
+		})
+		return
+	}
+	ctx.JSON(500, map[string]string{
+		"message": "Internal server error",
+	})
+}
+
+// openPrediction opens a prediction, the body has a title, outcomes and the seconds bets are taken for
+func openPrediction(ctx *gin.Context) {
+	u := getAuthedUser(ctx)
+
+	body := struct {
+		Title    string   `json:"title"`
+		Outcomes []string `json:"outcomes"`
+		Window   int      `json:"window"`
+	}{}
+	if err := json.NewDecoder(ctx.Request.Body).Decode(&body); err != nil {
+		log.Printf("msg='json-decode-error', error='%v'\n", err)
+		ctx.JSON(400, map[string]string{
+			"message": "Invalid JSON body",
+		})
+		return
+	}
+
+	p := predictions.New(body.Title, body.Outcomes, time.Duration(body.Window)*time.Second, u.User.Username)
+	if err := p.Validate(); err != nil {
+		ctx.JSON(422, map[string]string{
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if err := Bots.OpenPrediction(u.User.PublicId, p); err != nil {
+		predictionError(ctx, err)
+		return
+	}
+
+	ctx.JSON(200, p)
+}
+
+func lockPrediction(ctx *gin.Context) {
+	u := getAuthedUser(ctx)
+
+	p, err := Bots.LockPrediction(u.User.PublicId)
+	if err != nil {
+		predictionError(ctx, err)
+		return
+	}
+
+	ctx.JSON(200, p)
+}
+
+// resolvePrediction pays out the running prediction, the body has the number of the outcome that won
+func resolvePrediction(ctx *gin.Context) {
+	u := getAuthedUser(ctx)
+
+	body := struct {
+		Outcome int `json:"outcome"`
+	}{}
+	if err := json.NewDecoder(ctx.Request.Body).Decode(&body); err != nil {
+		log.Printf("msg='json-decode-error', error='%v'\n", err)
+		ctx.JSON(400, map[string]string{
+			"message": "Invalid JSON body",
+		})
+		return
+	}
+
+	p, err := Bots.ResolvePrediction(u.User.PublicId, body.Outcome)
+	if err == predictions.ErrInvalidOutcome {
+		ctx.JSON(422, map[string]string{
+			"message": err.Error(),
+		})
+		return
+	} else if err != nil {
+		predictionError(ctx, err)
+		return
+	}
+
+	ctx.JSON(200, p)
+}
+
+func refundPrediction(ctx *gin.Context) {
+	u := getAuthedUser(ctx)
+
+	p, err := Bots.RefundPrediction(u.User.PublicId)
+	if err != nil {
+		predictionError(ctx, err)
+		return
+	}
+
+	ctx.JSON(200, p)
+}
+
+// predictionError responds with the error of the running prediction
+func predictionError(ctx *gin.Context, err error) {
+	switch err {
+	case bot.ErrBotNotRunning, bot.ErrPointsOff, predictions.ErrPredictionRunning, predictions.ErrNoPrediction, predictions.ErrLocked:
+		ctx.JSON(409, map[string]string{
+			"message": err.Error(),
+		})
+	default:
+		ctx.JSON(500, map[string]string{
+			"message": "Internal server error",
+		})
+	}
+}
@@ -0,0 +1,180 @@
+package routes
+
+import (
+	"encoding/json"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/StreamMeBots/meep/pkg/quotes"
+)
+
+// getQuotes exports the quotes as JSON, or as CSV with ?format=csv
+func getQuotes(ctx *gin.Context) {
+	u := getAuthedUser(ctx)
+
+	qs, err := quotes.GetAll(u.User.BucketKey())
+	if err != nil {
+		ctx.JSON(500, map[string]string{
+			"message": "Internal server error",
+		})
+		return
+	}
+
+	if ctx.FormValue("format") != "csv" {
+		ctx.JSON(200, qs)
+		return
+	}
+
+	ctx.Header("Content-Type", "text/csv; charset=utf-8")
+	ctx.Header("Content-Disposition", `attachment; filename="quotes.csv"`)
+	ctx.Writer.WriteHeader(200)
+	if err := quotes.WriteCSV(ctx.Writer, qs); err != nil {
+		log.Printf("msg='error-writing-quotes-csv', userPublicId='%s', error='%v'\n", u.User.PublicId, err)
+	}
+}
+
+func getQuote(ctx *gin.Context) {
+	u := getAuthedUser(ctx)
+
+	id, err := strconv.ParseUint(ctx.ParamValue("id"), 10, 64)
+	if err != nil {
+		ctx.JSON(404, map[string]string{
+			"message": "Quote not found",
+		})
+		return
+	}
+
+	q, err := quotes.Get(u.User.BucketKey(), id)
+	if err == quotes.ErrQuoteNotFound {
+		ctx.JSON(404, map[string]string{
+			"message": "Quote not found",
+		})
+		return
+	} else if err != nil {
+		ctx.JSON(500, map[string]string{
+			"message": "Internal server error",
+		})
+		return
+	}
+
+	ctx.JSON(200, q)
+}
+
+func addQuote(ctx *gin.Context) {
+	u := getAuthedUser(ctx)
+
+	q := &quotes.Quote{}
+	if err := json.NewDecoder(ctx.Request.Body).Decode(&q); err != nil {
+		log.Printf("msg='json-decode-error', error='%v'\n", err)
+		ctx.JSON(400, map[string]string{
+			"message": "Invalid JSON body",
+		})
+		return
+	}
+	if len(q.AddedBy) == 0 {
+		q.AddedBy = u.User.Username
+	}
+
+	if err := q.Validate(); err != nil {
+		ctx.JSON(422, map[string]string{
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if err := quotes.Add(u.User.BucketKey(), q); err != nil {
+		ctx.JSON(500, map[string]string{
+			"message": "Internal server error",
+		})
+		return
+	}
+
+	ctx.JSON(200, q)
+}
+
+// importQuotes adds quotes from a JSON array or, with a text/csv content type, a CSV file. Imported quotes are given
+// new ids.
+func importQuotes(ctx *gin.Context) {
+	u := getAuthedUser(ctx)
+
+	qs := []*quotes.Quote{}
+	if strings.HasPrefix(ctx.ContentType(), "text/csv") {
+		var err error
+		if qs, err = quotes.ReadCSV(ctx.Request.Body); err != nil {
+			ctx.JSON(400, map[string]string{
+				"message": "Invalid CSV body: " + err.Error(),
+			})
+			return
+		}
+	} else if err := json.NewDecoder(ctx.Request.Body).Decode(&qs); err != nil {
+		log.Printf("msg='json-decode-error', error='%v'\n", err)
+		ctx.JSON(400, map[string]string{
+			"message": "Invalid JSON body",
+		})
+		return
+	}
+
+	if len(qs) > quotes.MaxImport {
+		ctx.JSON(422, map[string]string{
+			"message": "Too many quotes, import at most " + strconv.Itoa(quotes.MaxImport) + " at once",
+		})
+		return
+	}
+	for i, q := range qs {
+		if q == nil {
+			ctx.JSON(422, map[string]string{
+				"message": "Quote " + strconv.Itoa(i+1) + " is empty",
+			})
+			return
+		}
+	}
+	for i, q := range qs {
+		if len(q.AddedBy) == 0 {
+			q.AddedBy = u.User.Username
+		}
+		if err := q.Validate(); err != nil {
+			ctx.JSON(422, map[string]string{
+				"message": "Quote " + strconv.Itoa(i+1) + ": " + err.Error(),
+			})
+			return
+		}
+	}
+
+	if err := quotes.Import(u.User.BucketKey(), qs); err != nil {
+		ctx.JSON(500, map[string]string{
+			"message": "Internal server error",
+		})
+		return
+	}
+
+	ctx.JSON(200, qs)
+}
+
+func deleteQuote(ctx *gin.Context) {
+	u := getAuthedUser(ctx)
+
+	id, err := strconv.ParseUint(ctx.ParamValue("id"), 10, 64)
+	if err == nil {
+		err = quotes.Delete(u.User.BucketKey(), id)
+	} else {
+		err = quotes.ErrQuoteNotFound
+	}
+	if err == quotes.ErrQuoteNotFound {
+		ctx.JSON(404, map[string]string{
+			"message": "Quote not found",
+		})
+		return
+	} else if err != nil {
+		ctx.JSON(500, map[string]string{
+			"message": "Internal server error",
+		})
+		return
+	}
+
+	ctx.JSON(200, map[string]string{
+		"message": "Quote has been deleted",
+	})
+}
@@ -4,12 +4,12 @@ import (
 	"encoding/json"
 	"io"
 	"log"
-	"net/http"
 
 	"github.com/StreamMeBots/meep/pkg/bot"
 	"github.com/StreamMeBots/meep/pkg/command"
 	"github.com/StreamMeBots/meep/pkg/config"
 	"github.com/StreamMeBots/meep/pkg/greetings"
+	"github.com/StreamMeBots/meep/pkg/session"
 	pkgBot "github.com/StreamMeBots/pkg/bot"
 
 	"github.com/gin-gonic/gin"
@@ -36,6 +36,12 @@ func Init(r *gin.Engine) {
 	// setup oauth config
 	auth = newAuth(config.Conf)
 
+	// tokens are encrypted with the session key
+	if err := session.CheckKey(); err != nil {
+		log.Fatal(err)
+	}
+	go cleanupSessions()
+
 	// oauth2 login routes
 	r.GET("/login", auth.loginHandler)
 	r.GET("/login-redirect", auth.redirectHandler)
@@ -47,6 +53,13 @@ func Init(r *gin.Engine) {
 		// current user info
 		api.GET("/me", loggedInUser)
 
+		// Sessions
+		// list the user's logins
+		api.GET("/sessions", getSessions)
+
+		// revoke a login
+		api.DELETE("/sessions/:id", deleteSession)
+
 		// Bot
 		// Start bot
 		api.POST("/bot", startBot)
@@ -67,6 +80,13 @@ func Init(r *gin.Engine) {
 		// bot log
 		api.GET("/bot/log-stream", logStream)
 
+		// Settings
+		// get the bot settings, e.g. the streamer's timezone
+		api.GET("/settings", getSettings)
+
+		// save the bot settings
+		api.PUT("/settings", saveSettings)
+
 		// Commands
 		// get commands
 		api.GET("/commands", getCommands)
@@ -79,6 +99,196 @@ func Init(r *gin.Engine) {
 
 		// remove a command from the commands list
 		api.DELETE("/commands/:name", deleteCommand)
+
+		// Counters
+		// get the bot's counters
+		api.GET("/counters", getCounters)
+
+		// set a counter
+		api.PUT("/counters/:name", setCounter)
+
+		// add to a counter
+		api.POST("/counters/:name/increment", incrCounter)
+
+		// delete a counter
+		api.DELETE("/counters/:name", deleteCounter)
+
+		// Variables
+		// get the bot's variables
+		api.GET("/variables", getVariables)
+
+		// set a variable
+		api.PUT("/variables/:name", setVariable)
+
+		// delete a variable
+		api.DELETE("/variables/:name", deleteVariable)
+
+		// Polls
+		// get the finished polls
+		api.GET("/polls", getPolls)
+
+		// get the running poll
+		api.GET("/polls/active", getActivePoll)
+
+		// start a poll
+		api.POST("/polls", startPoll)
+
+		// Giveaways
+		// get the giveaways
+		api.GET("/giveaways", getGiveaways)
+
+		// get a giveaway with its entries and winners
+		api.GET("/giveaways/:id", getGiveaway)
+
+		// start a giveaway
+		api.POST("/giveaways", startGiveaway)
+
+		// draw a winner of the running giveaway
+		api.POST("/giveaways/draw", drawGiveaway)
+
+		// end the running giveaway
+		api.POST("/giveaways/end", endGiveaway)
+
+		// Points
+		// get the viewers' balances
+		api.GET("/points", getPoints)
+
+		// get the points ledger
+		api.GET("/points/ledger", getPointsLedger)
+
+		// get the points settings
+		api.GET("/points/settings", getPointsSettings)
+
+		// save the points settings
+		api.PUT("/points/settings", savePointsSettings)
+
+		// Predictions
+		// get the predictions
+		api.GET("/predictions", getPredictions)
+
+		// get a prediction with its bets and payouts
+		api.GET("/predictions/:id", getPrediction)
+
+		// open a prediction
+		api.POST("/predictions", openPrediction)
+
+		// lock the bets of the running prediction
+		api.POST("/predictions/lock", lockPrediction)
+
+		// pay out the running prediction
+		api.POST("/predictions/resolve", resolvePrediction)
+
+		// refund the running prediction
+		api.POST("/predictions/refund", refundPrediction)
+
+		// Trivia
+		// get the trivia settings
+		api.GET("/trivia/settings", getTriviaSettings)
+
+		// save the trivia settings
+		api.PUT("/trivia/settings", saveTriviaSettings)
+
+		// get the question packs
+		api.GET("/trivia/packs", getTriviaPacks)
+
+		// upload a question pack as JSON or CSV
+		api.POST("/trivia/packs", saveTriviaPack)
+
+		// get a question pack with its questions
+		api.GET("/trivia/packs/:name", getTriviaPack)
+
+		// delete a question pack
+		api.DELETE("/trivia/packs/:name", deleteTriviaPack)
+
+		// get the trivia leaderboard
+		api.GET("/trivia/scores", getTriviaScores)
+
+		// Transcripts
+		// search the chat transcript
+		api.GET("/transcripts", getTranscripts)
+
+		// Exports
+		// stream the chat transcript as NDJSON or CSV
+		api.GET("/export/transcript", exportTranscript)
+
+		// stream the stats as NDJSON or CSV
+		api.GET("/export/stats", exportStats)
+
+		// Stats
+		// get the chat line counts
+		api.GET("/stats/lines", getLineStats)
+
+		// get the most used commands
+		api.GET("/stats/commands", getTopCommands)
+
+		// get a command's use counts
+		api.GET("/stats/commands/:name", getCommandStats)
+
+		// Quotes
+		// get the quotes as JSON or CSV
+		api.GET("/quotes", getQuotes)
+
+		// add a quote
+		api.POST("/quotes", addQuote)
+
+		// add quotes from JSON or CSV
+		api.POST("/quotes/import", importQuotes)
+
+		// get a quote
+		api.GET("/quotes/:id", getQuote)
+
+		// delete a quote
+		api.DELETE("/quotes/:id", deleteQuote)
+
+		// Viewers
+		// get the viewers that have tags
+		api.GET("/viewers", getTaggedViewers)
+
+		// get a viewer's tags
+		api.GET("/viewers/:publicId/tags", getViewerTags)
+
+		// set a viewer's tags
+		api.PUT("/viewers/:publicId/tags", saveViewerTags)
+
+		// Moderation
+		// get moderation filters
+		api.GET("/moderation/filters", getFilters)
+
+		// create or update a filter
+		api.PUT("/moderation/filters", saveFilter)
+
+		// get a single filter
+		api.GET("/moderation/filters/:name", getFilter)
+
+		// remove a filter
+		api.DELETE("/moderation/filters/:name", deleteFilter)
+
+		// get the strike escalation ladder
+		api.GET("/moderation/ladder", getLadder)
+
+		// save the strike escalation ladder
+		api.PUT("/moderation/ladder", saveLadder)
+
+		// get every viewer's active strikes
+		api.GET("/moderation/strikes", getStrikes)
+
+		// give a viewer a strike
+		api.POST("/moderation/strikes", addStrike)
+
+		// get a viewer's active strikes
+		api.GET("/moderation/strikes/:publicId", getViewerStrikes)
+
+		// clear a viewer's strikes
+		api.DELETE("/moderation/strikes/:publicId", clearStrikes)
+
+		// get the active timeouts
+		api.GET("/moderation/timeouts", getTimeouts)
+
+		// time out a viewer
+		api.POST("/moderation/timeouts", addTimeout)
+
+		// end a viewer's timeout early
+		api.DELETE("/moderation/timeouts/:publicId", cancelTimeout)
 	}
 
 	// admin only routes
@@ -90,17 +300,27 @@ func Init(r *gin.Engine) {
 	*/
 }
 
+// RestartBots restarts the bots that were running when the server was shut down
+func RestartBots() {
+	Bots.Startup(auth.savedClient)
+}
+
+// Close stops all running bots and records them so they are restarted by RestartBots
+func Close() {
+	Bots.Close()
+}
+
 func loggedInUser(ctx *gin.Context) {
 	ctx.JSON(200, getAuthedUser(ctx).User)
 }
 
 func logout(ctx *gin.Context) {
-	http.SetCookie(ctx.Writer, &http.Cookie{
-		Name:   "sessid",
-		Value:  "",
-		Path:   "/",
-		MaxAge: -1,
-	})
+	if sessid := getSessId(ctx); len(sessid) > 0 {
+		session.Delete(sessid)
+		userClients.Remove(sessid)
+	}
+
+	setCookie(ctx, sessionCookie, "", -1)
 	ctx.Redirect(302, config.Conf.ServerHost)
 }
 
@@ -138,6 +358,12 @@ func logStream(ctx *gin.Context) {
 			ctx.SSEvent("write", t)
 		case pkgBot.EventWriteError:
 			ctx.SSEvent("writeError", t.Error())
+		case bot.EventPoll:
+			ctx.SSEvent("poll", t)
+		case bot.EventGiveaway:
+			ctx.SSEvent("giveaway", t)
+		case bot.EventPrediction:
+			ctx.SSEvent("prediction", t)
 		}
 		return true
 	})
@@ -238,6 +464,9 @@ func createCommand(ctx *gin.Context) {
 		return
 	}
 
+	// pick up any timer changes
+	Bots.ReloadCommandTimers(u.User.PublicId)
+
 	ctx.JSON(200, c)
 }
 
@@ -281,6 +510,8 @@ func deleteCommand(ctx *gin.Context) {
 		return
 	}
 
+	Bots.ReloadCommandTimers(u.User.PublicId)
+
 	ctx.JSON(200, map[string]string{
 		"message": "Command has been deleted",
 	})
@@ -0,0 +1,59 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"github.com/StreamMeBots/meep/pkg/session"
+)
+
+func getSessions(ctx *gin.Context) {
+	u := getAuthedUser(ctx)
+
+	sessions, err := session.GetByUser(u.User.PublicId)
+	if err != nil {
+		ctx.JSON(500, map[string]string{
+			"message": "Internal server error",
+		})
+		return
+	}
+
+	ctx.JSON(200, map[string]interface{}{
+		"sessions": sessions,
+		"current":  u.session.PublicId,
+	})
+}
+
+func deleteSession(ctx *gin.Context) {
+	u := getAuthedUser(ctx)
+
+	sessions, err := session.GetByUser(u.User.PublicId)
+	if err != nil {
+		ctx.JSON(500, map[string]string{
+			"message": "Internal server error",
+		})
+		return
+	}
+
+	for _, s := range sessions {
+		if s.PublicId != ctx.ParamValue("id") {
+			continue
+		}
+
+		if err := session.Delete(s.Id); err != nil {
+			ctx.JSON(500, map[string]string{
+				"message": "Internal server error",
+			})
+			return
+		}
+		userClients.Remove(s.Id)
+
+		ctx.JSON(200, map[string]string{
+			"message": "Session has been deleted",
+		})
+		return
+	}
+
+	ctx.JSON(404, map[string]string{
+		"message": "Session not found",
+	})
+}
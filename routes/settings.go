@@ -0,0 +1,53 @@
+package routes
+
+import (
+	"encoding/json"
+	"log"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/StreamMeBots/meep/pkg/user"
+)
+
+func getSettings(ctx *gin.Context) {
+	u := getAuthedUser(ctx)
+
+	s, err := user.GetSettings(u.User.BucketKey())
+	if err != nil {
+		ctx.JSON(500, map[string]string{
+			"message": "Internal server error",
+		})
+		return
+	}
+
+	ctx.JSON(200, s)
+}
+
+func saveSettings(ctx *gin.Context) {
+	u := getAuthedUser(ctx)
+
+	s := &user.Settings{}
+	if err := json.NewDecoder(ctx.Request.Body).Decode(&s); err != nil {
+		log.Printf("msg='json-decode-error', error='%v'\n", err)
+		ctx.JSON(400, map[string]string{
+			"message": "Invalid JSON body",
+		})
+		return
+	}
+
+	if err := s.Validate(); err != nil {
+		ctx.JSON(422, map[string]string{
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if err := s.Save(u.User.BucketKey()); err != nil {
+		ctx.JSON(500, map[string]string{
+			"message": "Internal server error",
+		})
+		return
+	}
+
+	ctx.JSON(200, s)
+}
@@ -0,0 +1,116 @@
+package routes
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/StreamMeBots/meep/pkg/stats"
+)
+
+// DefaultTopCommands is how many commands are listed when ?top= isn't set
+var DefaultTopCommands = 10
+
+// statsRange parses the ?from= and ?to= RFC3339 times and the ?granularity= of a stats query. to defaults to now
+// and from to the default range of the granularity. false is returned if the request was invalid and has been
+// responded to.
+func statsRange(ctx *gin.Context) (from, to time.Time, granularity string, ok bool) {
+	if from, to, ok = exportRange(ctx); !ok {
+		return
+	}
+
+	granularity = ctx.FormValue("granularity")
+	if len(granularity) == 0 {
+		granularity = stats.GranularityDay
+	}
+	if to.IsZero() {
+		to = time.Now()
+	}
+	if from.IsZero() {
+		from = stats.DefaultRange(granularity, to)
+	}
+	return from, to, granularity, true
+}
+
+// statsError responds with the error of a stats query
+func statsError(ctx *gin.Context, err error) {
+	switch err {
+	case stats.ErrInvalidGranularity, stats.ErrInvalidRange, stats.ErrTooManyPoints:
+		ctx.JSON(400, map[string]string{
+			"message": err.Error(),
+		})
+	default:
+		ctx.JSON(500, map[string]string{
+			"message": "Internal server error",
+		})
+	}
+}
+
+// getLineStats gets the chat line counts. ?from= and ?to= are RFC3339 times and ?granularity= is hour, day, week or
+// month.
+func getLineStats(ctx *gin.Context) {
+	u := getAuthedUser(ctx)
+
+	from, to, granularity, ok := statsRange(ctx)
+	if !ok {
+		return
+	}
+
+	s, err := stats.Lines(u.User.BucketKey(), from, to, granularity)
+	if err != nil {
+		statsError(ctx, err)
+		return
+	}
+
+	ctx.JSON(200, s)
+}
+
+// getCommandStats gets a command's use counts. ?from= and ?to= are RFC3339 times and ?granularity= is hour, day,
+// week or month.
+func getCommandStats(ctx *gin.Context) {
+	u := getAuthedUser(ctx)
+
+	from, to, granularity, ok := statsRange(ctx)
+	if !ok {
+		return
+	}
+
+	s, err := stats.Commands(u.User.BucketKey(), ctx.ParamValue("name"), from, to, granularity)
+	if err != nil {
+		statsError(ctx, err)
+		return
+	}
+
+	ctx.JSON(200, s)
+}
+
+// getTopCommands gets the most used commands. ?from= and ?to= are RFC3339 times and ?top= is how many commands are
+// listed.
+func getTopCommands(ctx *gin.Context) {
+	u := getAuthedUser(ctx)
+
+	from, to, _, ok := statsRange(ctx)
+	if !ok {
+		return
+	}
+
+	top := DefaultTopCommands
+	if t := ctx.FormValue("top"); len(t) > 0 {
+		var err error
+		if top, err = strconv.Atoi(t); err != nil || top < 1 {
+			ctx.JSON(400, map[string]string{
+				"message": "top should be a number above 0",
+			})
+			return
+		}
+	}
+
+	counts, err := stats.TopCommands(u.User.BucketKey(), from, to, top)
+	if err != nil {
+		statsError(ctx, err)
+		return
+	}
+
+	ctx.JSON(200, counts)
+}
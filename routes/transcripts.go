@@ -0,0 +1,68 @@
+package routes
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/StreamMeBots/meep/pkg/transcripts"
+)
+
+// getTranscripts searches the chat transcript, newest first. ?from= and ?to= are RFC3339 times, ?user= is a
+// username or public id, ?q= is text the messages contain and ?cursor= is the next value of the previous page. A page
+// can have fewer entries than the limit when few entries match, the search goes on while there's a next value.
+func getTranscripts(ctx *gin.Context) {
+	u := getAuthedUser(ctx)
+
+	q := transcripts.Query{
+		User:   ctx.FormValue("user"),
+		Text:   ctx.FormValue("q"),
+		Cursor: ctx.FormValue("cursor"),
+	}
+
+	var err error
+	if q.From, err = parseTime(ctx.FormValue("from")); err != nil {
+		ctx.JSON(400, map[string]string{
+			"message": "from should be an RFC3339 time",
+		})
+		return
+	}
+	if q.To, err = parseTime(ctx.FormValue("to")); err != nil {
+		ctx.JSON(400, map[string]string{
+			"message": "to should be an RFC3339 time",
+		})
+		return
+	}
+	if l := ctx.FormValue("limit"); len(l) > 0 {
+		if q.Limit, err = strconv.Atoi(l); err != nil || q.Limit < 1 || q.Limit > transcripts.MaxLimit {
+			ctx.JSON(400, map[string]string{
+				"message": "limit should be between 1 and " + strconv.Itoa(transcripts.MaxLimit),
+			})
+			return
+		}
+	}
+
+	p, err := transcripts.Search(u.User.BucketKey(), q)
+	if err == transcripts.ErrInvalidCursor {
+		ctx.JSON(400, map[string]string{
+			"message": err.Error(),
+		})
+		return
+	} else if err != nil {
+		ctx.JSON(500, map[string]string{
+			"message": "Internal server error",
+		})
+		return
+	}
+
+	ctx.JSON(200, p)
+}
+
+// parseTime parses an optional RFC3339 query value, the zero time is returned if it's empty
+func parseTime(s string) (time.Time, error) {
+	if len(s) == 0 {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
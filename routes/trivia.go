@@ -0,0 +1,178 @@
+package routes
+
+import (
+	"encoding/json"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/StreamMeBots/meep/pkg/trivia"
+)
+
+func getTriviaSettings(ctx *gin.Context) {
+	u := getAuthedUser(ctx)
+
+	s, err := trivia.GetSettings(u.User.BucketKey())
+	if err != nil {
+		ctx.JSON(500, map[string]string{
+			"message": "Internal server error",
+		})
+		return
+	}
+
+	ctx.JSON(200, s)
+}
+
+func saveTriviaSettings(ctx *gin.Context) {
+	u := getAuthedUser(ctx)
+
+	s := &trivia.Settings{}
+	if err := json.NewDecoder(ctx.Request.Body).Decode(&s); err != nil {
+		log.Printf("msg='json-decode-error', error='%v'\n", err)
+		ctx.JSON(400, map[string]string{
+			"message": "Invalid JSON body",
+		})
+		return
+	}
+
+	if err := s.Validate(); err != nil {
+		ctx.JSON(422, map[string]string{
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if err := s.Save(u.User.BucketKey()); err != nil {
+		ctx.JSON(500, map[string]string{
+			"message": "Internal server error",
+		})
+		return
+	}
+
+	ctx.JSON(200, s)
+}
+
+// getTriviaPacks gets the packs without their questions
+func getTriviaPacks(ctx *gin.Context) {
+	u := getAuthedUser(ctx)
+
+	ps, err := trivia.GetPacks(u.User.BucketKey())
+	if err != nil {
+		ctx.JSON(500, map[string]string{
+			"message": "Internal server error",
+		})
+		return
+	}
+
+	ctx.JSON(200, ps)
+}
+
+func getTriviaPack(ctx *gin.Context) {
+	u := getAuthedUser(ctx)
+
+	p, err := trivia.GetPack(u.User.BucketKey(), ctx.ParamValue("name"))
+	if err == trivia.ErrPackNotFound {
+		ctx.JSON(404, map[string]string{
+			"message": err.Error(),
+		})
+		return
+	} else if err != nil {
+		ctx.JSON(500, map[string]string{
+			"message": "Internal server error",
+		})
+		return
+	}
+
+	ctx.JSON(200, p)
+}
+
+// saveTriviaPack saves a pack from a JSON body with a name and questions or, with a text/csv content type, a CSV file
+// named by ?name=. A pack with the same name is replaced.
+func saveTriviaPack(ctx *gin.Context) {
+	u := getAuthedUser(ctx)
+
+	p := &trivia.Pack{}
+	if strings.HasPrefix(ctx.ContentType(), "text/csv") {
+		qs, err := trivia.ReadCSV(ctx.Request.Body)
+		if err != nil {
+			ctx.JSON(400, map[string]string{
+				"message": "Invalid CSV body: " + err.Error(),
+			})
+			return
+		}
+		p.Name = ctx.FormValue("name")
+		p.Questions = qs
+	} else if err := json.NewDecoder(ctx.Request.Body).Decode(&p); err != nil {
+		log.Printf("msg='json-decode-error', error='%v'\n", err)
+		ctx.JSON(400, map[string]string{
+			"message": "Invalid JSON body",
+		})
+		return
+	}
+
+	if err := p.Validate(); err != nil {
+		ctx.JSON(422, map[string]string{
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if err := p.Save(u.User.BucketKey()); err != nil {
+		ctx.JSON(500, map[string]string{
+			"message": "Internal server error",
+		})
+		return
+	}
+
+	p.Questions = nil
+	ctx.JSON(200, p)
+}
+
+func deleteTriviaPack(ctx *gin.Context) {
+	u := getAuthedUser(ctx)
+
+	err := trivia.DeletePack(u.User.BucketKey(), ctx.ParamValue("name"))
+	if err == trivia.ErrPackNotFound {
+		ctx.JSON(404, map[string]string{
+			"message": err.Error(),
+		})
+		return
+	} else if err != nil {
+		ctx.JSON(500, map[string]string{
+			"message": "Internal server error",
+		})
+		return
+	}
+
+	ctx.JSON(200, map[string]string{
+		"message": "Trivia pack has been deleted",
+	})
+}
+
+// getTriviaScores gets the leaderboard, ?limit=n gets the top n
+func getTriviaScores(ctx *gin.Context) {
+	u := getAuthedUser(ctx)
+
+	limit := 0
+	if l := ctx.FormValue("limit"); len(l) > 0 {
+		var err error
+		if limit, err = strconv.Atoi(l); err != nil || limit < 0 {
+			ctx.JSON(400, map[string]string{
+				"message": "Invalid limit",
+			})
+			return
+		}
+	}
+
+	scores, err := trivia.GetScores(u.User.BucketKey(), limit)
+	if err != nil {
+		ctx.JSON(500, map[string]string{
+			"message": "Internal server error",
+		})
+		return
+	}
+
+	ctx.JSON(200, scores)
+}
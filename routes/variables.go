@@ -0,0 +1,174 @@
+package routes
+
+import (
+	"encoding/json"
+	"log"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/StreamMeBots/meep/pkg/variables"
+)
+
+func getCounters(ctx *gin.Context) {
+	u := getAuthedUser(ctx)
+
+	counters, err := variables.GetAllCounters(u.User.BucketKey())
+	if err != nil {
+		ctx.JSON(500, map[string]string{
+			"message": "Internal server error",
+		})
+		return
+	}
+
+	ctx.JSON(200, counters)
+}
+
+func setCounter(ctx *gin.Context) {
+	u := getAuthedUser(ctx)
+
+	c := &variables.Counter{}
+	if err := json.NewDecoder(ctx.Request.Body).Decode(&c); err != nil {
+		log.Printf("msg='json-decode-error', error='%v'\n", err)
+		ctx.JSON(400, map[string]string{
+			"message": "Invalid JSON body",
+		})
+		return
+	}
+	c.Name = variables.Name(ctx.ParamValue("name"))
+
+	if err := variables.ValidateName(c.Name); err != nil {
+		ctx.JSON(422, map[string]string{
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if err := variables.SetCounter(u.User.BucketKey(), c.Name, c.Value); err != nil {
+		ctx.JSON(500, map[string]string{
+			"message": "Internal server error",
+		})
+		return
+	}
+
+	ctx.JSON(200, c)
+}
+
+func incrCounter(ctx *gin.Context) {
+	u := getAuthedUser(ctx)
+
+	body := struct {
+		By int64 `json:"by"`
+	}{}
+	if err := json.NewDecoder(ctx.Request.Body).Decode(&body); err != nil {
+		log.Printf("msg='json-decode-error', error='%v'\n", err)
+		ctx.JSON(400, map[string]string{
+			"message": "Invalid JSON body",
+		})
+		return
+	}
+
+	c := &variables.Counter{Name: variables.Name(ctx.ParamValue("name"))}
+	if err := variables.ValidateName(c.Name); err != nil {
+		ctx.JSON(422, map[string]string{
+			"message": err.Error(),
+		})
+		return
+	}
+
+	var err error
+	c.Value, err = variables.Incr(u.User.BucketKey(), c.Name, body.By)
+	if err != nil {
+		ctx.JSON(500, map[string]string{
+			"message": "Internal server error",
+		})
+		return
+	}
+
+	ctx.JSON(200, c)
+}
+
+func deleteCounter(ctx *gin.Context) {
+	u := getAuthedUser(ctx)
+
+	err := variables.DeleteCounter(u.User.BucketKey(), ctx.ParamValue("name"))
+	if err == variables.ErrNotFound {
+		ctx.JSON(404, map[string]string{
+			"message": "Counter not found",
+		})
+		return
+	} else if err != nil {
+		ctx.JSON(500, map[string]string{
+			"message": "Internal server error",
+		})
+		return
+	}
+
+	ctx.JSON(200, map[string]string{
+		"message": "Counter has been deleted",
+	})
+}
+
+func getVariables(ctx *gin.Context) {
+	u := getAuthedUser(ctx)
+
+	vars, err := variables.GetAllVars(u.User.BucketKey())
+	if err != nil {
+		ctx.JSON(500, map[string]string{
+			"message": "Internal server error",
+		})
+		return
+	}
+
+	ctx.JSON(200, vars)
+}
+
+func setVariable(ctx *gin.Context) {
+	u := getAuthedUser(ctx)
+
+	v := &variables.Variable{}
+	if err := json.NewDecoder(ctx.Request.Body).Decode(&v); err != nil {
+		log.Printf("msg='json-decode-error', error='%v'\n", err)
+		ctx.JSON(400, map[string]string{
+			"message": "Invalid JSON body",
+		})
+		return
+	}
+	v.Name = variables.Name(ctx.ParamValue("name"))
+
+	if err := v.Validate(); err != nil {
+		ctx.JSON(422, map[string]string{
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if err := v.Save(u.User.BucketKey()); err != nil {
+		ctx.JSON(500, map[string]string{
+			"message": "Internal server error",
+		})
+		return
+	}
+
+	ctx.JSON(200, v)
+}
+
+func deleteVariable(ctx *gin.Context) {
+	u := getAuthedUser(ctx)
+
+	err := variables.DeleteVar(u.User.BucketKey(), ctx.ParamValue("name"))
+	if err == variables.ErrNotFound {
+		ctx.JSON(404, map[string]string{
+			"message": "Variable not found",
+		})
+		return
+	} else if err != nil {
+		ctx.JSON(500, map[string]string{
+			"message": "Internal server error",
+		})
+		return
+	}
+
+	ctx.JSON(200, map[string]string{
+		"message": "Variable has been deleted",
+	})
+}
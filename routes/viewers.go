@@ -0,0 +1,68 @@
+package routes
+
+import (
+	"encoding/json"
+	"log"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/StreamMeBots/meep/pkg/viewers"
+)
+
+func getTaggedViewers(ctx *gin.Context) {
+	u := getAuthedUser(ctx)
+
+	tags, err := viewers.GetAllTags(u.User.BucketKey())
+	if err != nil {
+		ctx.JSON(500, map[string]string{
+			"message": "Internal server error",
+		})
+		return
+	}
+
+	ctx.JSON(200, tags)
+}
+
+func getViewerTags(ctx *gin.Context) {
+	u := getAuthedUser(ctx)
+
+	tags, err := viewers.GetTags(u.User.BucketKey(), ctx.ParamValue("publicId"))
+	if err != nil {
+		ctx.JSON(500, map[string]string{
+			"message": "Internal server error",
+		})
+		return
+	}
+
+	ctx.JSON(200, tags)
+}
+
+func saveViewerTags(ctx *gin.Context) {
+	u := getAuthedUser(ctx)
+
+	tags := &viewers.Tags{}
+	if err := json.NewDecoder(ctx.Request.Body).Decode(&tags); err != nil {
+		log.Printf("msg='json-decode-error', error='%v'\n", err)
+		ctx.JSON(400, map[string]string{
+			"message": "Invalid JSON body",
+		})
+		return
+	}
+	tags.UserPublicId = ctx.ParamValue("publicId")
+
+	if err := tags.Validate(); err != nil {
+		ctx.JSON(422, map[string]string{
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if err := tags.Save(u.User.BucketKey()); err != nil {
+		ctx.JSON(500, map[string]string{
+			"message": "Internal server error",
+		})
+		return
+	}
+
+	ctx.JSON(200, tags)
+}